@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	converter "github.com/lubieniebieski/markdown-tools/pkg"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the " + converter.ConfigFileName + " configuration files",
+	Long:  `Settings are read from the ` + converter.ConfigFileName + ` files found in the directory of every processed file and in its parents, up to the first one with root: true. The closer a file is, the stronger its settings, and flags given on the command line take precedence over all of them`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [PATH]",
+	Short: "Print the configuration used for the files in a directory",
+	Long:  `Print the settings used for the given file or directory (the current one by default), merged from all the configuration files that apply to it, with the defaults for the settings none of them sets`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if err := showConfig(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// showConfig prints the effective configuration of the path as YAML,
+// preceded by the list of files it comes from
+func showConfig(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	config, err := converter.FindConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if len(config.Sources) == 0 {
+		fmt.Println("# No configuration file found, using the defaults")
+	}
+	for _, source := range config.Sources {
+		fmt.Printf("# %s\n", source)
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(converter.DefaultConfig().Merge(config)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	converter "github.com/lubieniebieski/markdown-tools/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+var createBackup bool
+var verbose bool
+var dryRun bool
+var color bool
+var check bool
+var readStdin bool
+var outputDir string
+var extensions []string
+var include []string
+var exclude []string
+var noDefaultExclude bool
+var gitignore bool
+var jobs int
+var noConfig bool
+
+// addFileFlags adds the flags shared by the commands converting files
+func addFileFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&createBackup, "backup", "b", false, "Create backup file(s)")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Print a diff of the changes without writing any file")
+	cmd.Flags().BoolVar(&dryRun, "diff", false, "Same as --dry-run")
+	cmd.Flags().BoolVar(&color, "color", false, "Colorize the diff printed with --dry-run")
+	cmd.Flags().BoolVar(&check, "check", false, "List files that need changes without writing any file")
+	cmd.Flags().BoolVar(&readStdin, "stdin", false, "Read from standard input and write to standard output")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "Write converted files to this directory, keeping their relative paths, instead of updating them")
+	cmd.Flags().StringSliceVar(&extensions, "ext", converter.DefaultExtensions, "Extensions of the files to process, e.g. --ext .md,.markdown,.mdx,.mdown")
+	cmd.Flags().StringSliceVar(&include, "include", nil, "Only process files matching one of these glob patterns")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Skip files and directories matching one of these glob patterns, besides "+strings.Join(converter.DefaultExclude, ", "))
+	cmd.Flags().BoolVar(&noDefaultExclude, "no-default-exclude", false, "Process the files in "+strings.Join(converter.DefaultExclude, ", ")+" too")
+	cmd.Flags().BoolVar(&gitignore, "gitignore", false, "Skip files and directories ignored by git")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Number of files processed at the same time (default: number of CPUs)")
+	cmd.Flags().BoolVar(&noConfig, "no-config", false, "Ignore the "+converter.ConfigFileName+" configuration files")
+	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print verbose output")
+
+	for _, name := range fileOnlyFlags {
+		cmd.MarkFlagsMutuallyExclusive("stdin", name)
+	}
+}
+
+// fileOnlyFlags are the flags that only apply to files, not to standard input
+var fileOnlyFlags = []string{"backup", "dry-run", "diff", "check", "output-dir"}
+
+// pathsOrStdin requires at least one path, unless reading from standard input
+func pathsOrStdin(cmd *cobra.Command, args []string) error {
+	if readStdin {
+		return cobra.NoArgs(cmd, args)
+	}
+	// Unlike --stdin, - is an argument that the flag groups don't know about
+	if usesStdin(args) {
+		for _, name := range fileOnlyFlags {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s cannot be used when reading from standard input", name)
+			}
+		}
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+func usesStdin(args []string) bool {
+	return readStdin || (len(args) == 1 && args[0] == "-")
+}
+
+func runOnFilesOrStdin(cmd *cobra.Command, args []string,
+	processFiles func([]string, converter.FileOptions) (converter.Summary, error),
+	processStream func(io.Reader, io.Writer, converter.Options) error) {
+	conversion, err := conversionOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	var config *converter.Config
+	if !noConfig {
+		flags := flagsConfig(cmd)
+		config = &flags
+	}
+
+	if usesStdin(args) {
+		// Standard input uses the configuration of the current directory
+		if config != nil {
+			found, err := converter.FindConfig(".")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitFailure)
+			}
+			conversion = found.Merge(*config).Apply(converter.FileOptions{Conversion: conversion}).Conversion
+		}
+		if err := processStream(os.Stdin, os.Stdout, conversion); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	summary, err := processFiles(args, converter.FileOptions{
+		Backup:           createBackup,
+		Verbose:          verbose,
+		DryRun:           dryRun,
+		Color:            color,
+		Check:            check,
+		OutputDir:        outputDir,
+		Extensions:       extensions,
+		Include:          include,
+		Exclude:          exclude,
+		NoDefaultExclude: noDefaultExclude,
+		Gitignore:        gitignore,
+		Jobs:             jobs,
+		Conversion:       conversion,
+		Config:           config,
+	})
+	printSummary(summary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if (dryRun || check) && summary.Changed > 0 {
+		os.Exit(exitChanges)
+	}
+}
+
+// conversionOptions returns the options of the conversion set by the flags
+func conversionOptions() (converter.Options, error) {
+	imagePolicy, err := converter.ParseImagePolicy(images)
+	if err != nil {
+		return converter.Options{}, err
+	}
+	autolinkPolicy, err := converter.ParseAutolinkPolicy(autolinks)
+	if err != nil {
+		return converter.Options{}, err
+	}
+	idStrategy, err := converter.ParseIDStrategy(ids)
+	if err != nil {
+		return converter.Options{}, err
+	}
+	footnotePolicy, err := converter.ParseFootnotePolicy(footnotes)
+	if err != nil {
+		return converter.Options{}, err
+	}
+	definitionPlacement, err := converter.ParsePlacement(placement)
+	if err != nil {
+		return converter.Options{}, err
+	}
+	options := converter.Options{
+		Images:       imagePolicy,
+		Autolinks:    autolinkPolicy,
+		IDs:          idStrategy,
+		Renumber:     renumber,
+		Footnotes:    footnotePolicy,
+		Placement:    definitionPlacement,
+		SectionLevel: sectionLevel,
+	}
+
+	switch autolinkText {
+	case "", "host":
+	case "title":
+		options.AutolinkText = converter.PageTitle
+	default:
+		return converter.Options{}, fmt.Errorf("unknown autolink text %q, expected host or title", autolinkText)
+	}
+	return options, nil
+}
+
+// flagsConfig returns the settings given on the command line, which take
+// precedence over the ones of the configuration files
+func flagsConfig(cmd *cobra.Command) converter.Config {
+	var config converter.Config
+	flags := cmd.Flags()
+	if flags.Changed("backup") {
+		config.Backup = &createBackup
+	}
+	if flags.Changed("ids") {
+		config.IDs = converter.IDStrategy(ids)
+	}
+	if flags.Changed("placement") {
+		config.Placement = converter.Placement(placement)
+	}
+	if flags.Changed("section-level") {
+		config.SectionLevel = &sectionLevel
+	}
+	if flags.Changed("images") {
+		config.Images = converter.ImagePolicy(images)
+	}
+	if flags.Changed("autolinks") {
+		config.Autolinks = converter.AutolinkPolicy(autolinks)
+	}
+	if flags.Changed("footnotes") {
+		config.Footnotes = converter.FootnotePolicy(footnotes)
+	}
+	if flags.Changed("renumber") {
+		config.Renumber = &renumber
+	}
+	return config
+}
+
+// printSummary prints the summary to standard output, unless it is used for
+// diffs or the list of files to check
+func printSummary(summary converter.Summary) {
+	out := os.Stdout
+	changed := "changed"
+	if dryRun || check {
+		out = os.Stderr
+		changed = "to change"
+	}
+	fmt.Fprintf(out, "Completed! %d processed, %d %s, %d failed\n", summary.Processed, summary.Changed, changed, summary.Failed)
+}
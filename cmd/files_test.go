@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestPathsOrStdin(t *testing.T) {
+	for _, name := range fileOnlyFlags {
+		t.Run("rejects --"+name+" with -", func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addFileFlags(cmd)
+			value := "true"
+			if name == "output-dir" {
+				value = t.TempDir()
+			}
+			if err := cmd.Flags().Set(name, value); err != nil {
+				t.Fatalf("Failed to set --%s: %v", name, err)
+			}
+
+			err := pathsOrStdin(cmd, []string{"-"})
+			if err == nil || !strings.Contains(err.Error(), "--"+name) {
+				t.Errorf("Expected an error about --%s, but got %v", name, err)
+			}
+			if err := pathsOrStdin(cmd, []string{"README.md"}); err != nil {
+				t.Errorf("Expected no error for a path, but got %v", err)
+			}
+		})
+	}
+
+	t.Run("accepts - alone", func(t *testing.T) {
+		cmd := &cobra.Command{}
+		addFileFlags(cmd)
+
+		if err := pathsOrStdin(cmd, []string{"-"}); err != nil {
+			t.Errorf("Expected no error, but got %v", err)
+		}
+	})
+}
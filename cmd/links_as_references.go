@@ -6,22 +6,35 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var createBackup bool
-var verbose bool
+var images string
+var autolinks string
+var autolinkText string
+var ids string
+var renumber bool
+var footnotes string
+var placement string
+var sectionLevel int
 
 var linksAsReferencesCmd = &cobra.Command{
-	Use:   "links_as_references",
+	Use:   "links_as_references <PATH>...",
 	Short: "Replace all inline links in a Markdown file(s)",
-	Long:  `It can change either one file or many, you can provide a single file name or entire directory - it will process all files with .md extension`,
-	Args:  cobra.MinimumNArgs(1),
+	Long:  `It can change either one file or many, you can provide a single file name or entire directory - it will process all files with .md extension (see --ext, --include, --exclude and --gitignore). Many paths can be given at once. Use - (or --stdin) to read from standard input and write to standard output instead`,
+	Args:  pathsOrStdin,
 	Run: func(cmd *cobra.Command, args []string) {
-		converter.ConvertFilesInPath(args[0], createBackup, verbose)
+		runOnFilesOrStdin(cmd, args, converter.ConvertFilesInPaths, converter.ConvertStream)
 	},
 }
 
 func init() {
-	linksAsReferencesCmd.Flags().BoolVarP(&createBackup, "backup", "b", false, "Create backup file(s)")
-	linksAsReferencesCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print verbose output")
+	addFileFlags(linksAsReferencesCmd)
+	linksAsReferencesCmd.Flags().StringVar(&images, "images", string(converter.ImagesReference), "What to do with images: reference, inline or skip")
+	linksAsReferencesCmd.Flags().StringVar(&ids, "ids", string(converter.IDsNumeric), "IDs of new references: numeric, slug (from the link text), domain (e.g. github-com-1) or hash (of the URL)")
+	linksAsReferencesCmd.Flags().BoolVar(&renumber, "renumber", false, "Renumber numeric IDs in the order the links are first used")
+	linksAsReferencesCmd.Flags().StringVar(&footnotes, "footnotes", string(converter.FootnotesKeep), "What to do with footnotes: keep or reference (convert inline footnotes and renumber footnotes in order)")
+	linksAsReferencesCmd.Flags().StringVar(&placement, "placement", string(converter.PlacementEnd), "Where to put the definitions: end (of the file), section (end of each section) or markers (between <!-- references --> and <!-- /references -->)")
+	linksAsReferencesCmd.Flags().IntVar(&sectionLevel, "section-level", 0, "With --placement section, only headings of this level or a higher one (1 being the highest) end a section, 0 for any heading")
+	linksAsReferencesCmd.Flags().StringVar(&autolinks, "autolinks", string(converter.AutolinksKeep), "What to do with autolinks and bare URLs: keep, reference or normalize (put bare URLs in angle brackets)")
+	linksAsReferencesCmd.Flags().StringVar(&autolinkText, "autolink-text", "host", "Text of the links made from autolinks: host (of the URL) or title (of the page, fetched from the web)")
 
 	rootCmd.AddCommand(linksAsReferencesCmd)
 }
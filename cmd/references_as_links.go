@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	converter "github.com/lubieniebieski/markdown-tools/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+var referencesAsLinksCmd = &cobra.Command{
+	Use:   "references_as_links <PATH>...",
+	Short: "Replace all reference links in a Markdown file(s) with inline links",
+	Long:  `The opposite of links_as_references: every [text][id] with a matching [id]: url definition becomes [text](url), and the definitions that are no longer used are removed. It accepts file names, entire directories or - for standard input, just like links_as_references`,
+	Args:  pathsOrStdin,
+	Run: func(cmd *cobra.Command, args []string) {
+		runOnFilesOrStdin(cmd, args, converter.InlineFilesInPaths, converter.InlineStream)
+	},
+}
+
+func init() {
+	addFileFlags(referencesAsLinksCmd)
+
+	rootCmd.AddCommand(referencesAsLinksCmd)
+}
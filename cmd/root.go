@@ -29,6 +29,13 @@ import (
 
 var version = "0.4.2"
 
+// Exit codes used by the commands, besides 0 for success
+const (
+	exitFailure = 1
+	// exitChanges means that some files need changes that were not written
+	exitChanges = 2
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "markdown-tools",
@@ -40,7 +47,7 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 }
 
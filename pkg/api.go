@@ -0,0 +1,220 @@
+// Package converter rewrites links in Markdown documents, turning inline
+// links into references or the other way around.
+//
+// It can be used as a library through Converter:
+//
+//	c := converter.NewConverter(converter.Options{})
+//	result, err := c.Convert(ctx, input, output)
+//
+// The Result lists the edits made to the document, which editors can apply
+// themselves. Any document can be given to a Converter, which returns an
+// error if it cannot convert the document. The conversion is fuzzed not to
+// panic, whatever the input. The panics of the functions given in Options
+// reach the caller.
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Options controls how a Converter rewrites links
+type Options struct {
+	// Inline converts references to inline links, instead of the default
+	// conversion of inline links to references
+	Inline bool
+	// Images is what happens to images when converting inline links to
+	// references, ImagesReference if empty
+	Images ImagePolicy
+	// Autolinks is what happens to autolinks (`<https://...>`) and bare URLs
+	// when converting inline links to references, AutolinksKeep if empty
+	Autolinks AutolinkPolicy
+	// AutolinkText returns the text of the links made from autolinks, like
+	// PageTitle does. The host of the URL is used if it is nil or returns
+	// an empty string.
+	AutolinkText func(url string) string
+	// IDs is how the IDs of new references are chosen, IDsNumeric if empty
+	IDs IDStrategy
+	// Renumber gives the references with numeric IDs new numbers following
+	// the order in which they are first used
+	Renumber bool
+	// Footnotes is what happens to footnotes, FootnotesKeep if empty
+	Footnotes FootnotePolicy
+	// Placement is where the definitions go, PlacementEnd if empty
+	Placement Placement
+	// SectionLevel is the level of the headings ending the sections with
+	// PlacementSection: headings of this level or a lower one end a section,
+	// all headings do if it is 0
+	SectionLevel int
+}
+
+// ImagePolicy tells how images are converted
+type ImagePolicy string
+
+const (
+	// ImagesReference converts inline images to references, like links,
+	// with their definitions grouped apart from the other ones
+	ImagesReference ImagePolicy = "reference"
+	// ImagesInline converts references used by images only to inline images
+	ImagesInline ImagePolicy = "inline"
+	// ImagesSkip leaves images as they are
+	ImagesSkip ImagePolicy = "skip"
+)
+
+// convertsImages tells if inline images are converted to references
+func (p ImagePolicy) convertsImages() bool {
+	return p == "" || p == ImagesReference
+}
+
+// AutolinkPolicy tells how autolinks and bare URLs are converted
+type AutolinkPolicy string
+
+const (
+	// AutolinksKeep leaves autolinks and bare URLs as they are
+	AutolinksKeep AutolinkPolicy = "keep"
+	// AutolinksReference converts autolinks and bare URLs to reference links
+	AutolinksReference AutolinkPolicy = "reference"
+	// AutolinksNormalize puts bare URLs in angle brackets
+	AutolinksNormalize AutolinkPolicy = "normalize"
+)
+
+// ParseAutolinkPolicy returns the autolink policy with the given name
+func ParseAutolinkPolicy(name string) (AutolinkPolicy, error) {
+	switch policy := AutolinkPolicy(name); policy {
+	case AutolinksKeep, AutolinksReference, AutolinksNormalize:
+		return policy, nil
+	case "":
+		return AutolinksKeep, nil
+	}
+	return "", fmt.Errorf("unknown autolink policy %q, expected keep, reference or normalize", name)
+}
+
+// ParseImagePolicy returns the image policy with the given name
+func ParseImagePolicy(name string) (ImagePolicy, error) {
+	switch policy := ImagePolicy(name); policy {
+	case ImagesReference, ImagesInline, ImagesSkip:
+		return policy, nil
+	case "":
+		return ImagesReference, nil
+	}
+	return "", fmt.Errorf("unknown image policy %q, expected reference, inline or skip", name)
+}
+
+// Converter converts links in Markdown documents. It holds no state besides
+// its options, so it can be used for many documents, also concurrently.
+type Converter struct {
+	options Options
+}
+
+// Result describes a converted document
+type Result struct {
+	// Links are the links found in the document
+	Links []Link
+	// Changed is true if the output differs from the input
+	Changed bool
+	// Skipped is true if the front matter of the document asks for it to
+	// be left as it is
+	Skipped bool
+	// Edits are the changes turning the input into the output, sorted and
+	// not overlapping, for editors to apply as text edits instead of
+	// replacing the whole document. Everything else is left byte for byte
+	// as it was.
+	Edits []Edit
+}
+
+// Edit replaces the bytes from Start to End (excluded) of a document with
+// Text. Offsets are counted in bytes from the start of the input, and never
+// split a character.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// ApplyEdits returns a copy of the content with the edits applied, which
+// must be as in Result.Edits: within the content, sorted and not
+// overlapping. It returns an error otherwise.
+func ApplyEdits(content []byte, edits []Edit) ([]byte, error) {
+	var output bytes.Buffer
+	last := 0
+	for i, e := range edits {
+		if e.Start < 0 || e.End < e.Start || e.End > len(content) {
+			return nil, fmt.Errorf("edit %d replaces bytes %d to %d, out of the %d bytes of the content", i, e.Start, e.End, len(content))
+		}
+		if e.Start < last {
+			return nil, fmt.Errorf("edit %d starts at byte %d, before the end of the previous one at byte %d", i, e.Start, last)
+		}
+		output.Write(content[last:e.Start])
+		output.WriteString(e.Text)
+		last = e.End
+	}
+	output.Write(content[last:])
+	return output.Bytes(), nil
+}
+
+// NewConverter returns a Converter using the options. The zero Options
+// convert inline links and images to references with numeric IDs, defined
+// at the end of the document along with the existing ones, which keep their
+// IDs. Autolinks and footnotes are left as they are.
+func NewConverter(options Options) *Converter {
+	return &Converter{options: options}
+}
+
+// Convert reads a Markdown document from r and writes the converted document to w
+func (c *Converter) Convert(ctx context.Context, r io.Reader, w io.Writer) (Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, fmt.Errorf("reading input: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	output, result, err := c.convert(content)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if _, err := w.Write(output); err != nil {
+		return Result{}, fmt.Errorf("writing output: %w", err)
+	}
+	return result, nil
+}
+
+// convert converts the document. Its front matter is kept as it is, and the
+// settings found in it take precedence over the options of the converter.
+func (c *Converter) convert(content []byte) ([]byte, Result, error) {
+	frontMatter, body := splitFrontMatter(content)
+	settings, err := parseFrontMatterSettings(frontMatter)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	if settings.Skip || (frontMatter != nil && len(bytes.TrimSpace(body)) == 0) {
+		return content, Result{Skipped: settings.Skip}, nil
+	}
+	options := settings.config().applyConversion(c.options)
+
+	var output []byte
+	var links []Link
+	var edits []edit
+	if options.Inline {
+		ri := ReferenceInliner{originalContent: body}
+		ri.Run()
+		output, links, edits = ri.modifiedContent, ri.Links, ri.edits
+	} else {
+		mc := MarkdownConverter{originalContent: body, options: options}
+		mc.Run()
+		output, links, edits = mc.modifiedContent, mc.Links, mc.edits
+	}
+	output = append(frontMatter[:len(frontMatter):len(frontMatter)], output...)
+	result := Result{Links: links, Changed: !bytes.Equal(content, output)}
+	// The edits of the body are moved past the front matter
+	for _, e := range edits {
+		result.Edits = append(result.Edits, Edit{Start: len(frontMatter) + e.start, End: len(frontMatter) + e.end, Text: e.replacement})
+	}
+	return output, result, nil
+}
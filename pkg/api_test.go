@@ -0,0 +1,159 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConverterConvert(t *testing.T) {
+	t.Run("converts inline links to references", func(t *testing.T) {
+		input := strings.NewReader("[Google](https://www.google.com) and [GitHub][gh]\n\n[gh]: https://github.com\n")
+		expectedOutput := []byte("[Google][1] and [GitHub][gh]\n\n[1]: https://www.google.com\n\n[gh]: https://github.com\n")
+
+		var output bytes.Buffer
+		result, err := NewConverter(Options{}).Convert(context.Background(), input, &output)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		compareResults(output.Bytes(), expectedOutput, t)
+		if !result.Changed {
+			t.Errorf("Expected the result to be changed")
+		}
+		assertLinksEqual(t, result.Links, []Link{
+			{Name: "", URL: "https://github.com", ID: "gh"},
+			{Name: "Google", URL: "https://www.google.com", ID: "1"},
+		})
+	})
+
+	t.Run("converts references to inline links", func(t *testing.T) {
+		input := strings.NewReader("[GitHub][gh]\n\n[gh]: https://github.com\n")
+		expectedOutput := []byte("[GitHub](https://github.com)\n")
+
+		var output bytes.Buffer
+		result, err := NewConverter(Options{Inline: true}).Convert(context.Background(), input, &output)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		compareResults(output.Bytes(), expectedOutput, t)
+		assertLinksEqual(t, result.Links, []Link{
+			{Name: "GitHub", URL: "https://github.com", ID: "gh"},
+		})
+	})
+
+	t.Run("returns the edits turning the input into the output", func(t *testing.T) {
+		input := []byte("---\ntitle: x\n---\nSee [Google](https://www.google.com).\n")
+
+		var output bytes.Buffer
+		result, err := NewConverter(Options{}).Convert(context.Background(), bytes.NewReader(input), &output)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		expectedEdits := []Edit{
+			{Start: 29, End: 53, Text: "[1]"},
+			{Start: 55, End: 55, Text: "\n[1]: https://www.google.com\n"},
+		}
+		if fmt.Sprint(result.Edits) != fmt.Sprint(expectedEdits) {
+			t.Errorf("Expected edits %+v, but got %+v", expectedEdits, result.Edits)
+		}
+		applied, err := ApplyEdits(input, result.Edits)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		compareResults(applied, output.Bytes(), t)
+	})
+
+	t.Run("reports unchanged content", func(t *testing.T) {
+		input := strings.NewReader("first line\n")
+
+		var output bytes.Buffer
+		result, err := NewConverter(Options{}).Convert(context.Background(), input, &output)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if result.Changed {
+			t.Errorf("Expected the result not to be changed")
+		}
+	})
+
+	t.Run("returns read errors", func(t *testing.T) {
+		readErr := errors.New("broken input")
+
+		_, err := NewConverter(Options{}).Convert(context.Background(), failingReader{readErr}, &bytes.Buffer{})
+		if !errors.Is(err, readErr) {
+			t.Errorf("Expected error %v, but got %v", readErr, err)
+		}
+	})
+
+	t.Run("stops when the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var output bytes.Buffer
+		_, err := NewConverter(Options{}).Convert(ctx, strings.NewReader("[a](b)"), &output)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected error %v, but got %v", context.Canceled, err)
+		}
+		if output.Len() != 0 {
+			t.Errorf("Expected no output, but got %q", output.String())
+		}
+	})
+
+	t.Run("lets the panics of the options through", func(t *testing.T) {
+		options := Options{Autolinks: AutolinksReference, AutolinkText: func(string) string { panic("no title") }}
+
+		defer func() {
+			if r := recover(); r != "no title" {
+				t.Errorf("Expected the panic of AutolinkText, but got %v", r)
+			}
+		}()
+		_, _ = NewConverter(options).Convert(context.Background(), strings.NewReader("<https://go.dev>"), &bytes.Buffer{})
+	})
+}
+
+func TestApplyEdits(t *testing.T) {
+	content := []byte("first line\nsecond line\n")
+
+	output, err := ApplyEdits(content, []Edit{{Start: 0, End: 5, Text: "1st"}, {Start: 11, End: 11, Text: "new line\n"}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	compareResults(output, []byte("1st line\nnew line\nsecond line\n"), t)
+
+	for name, edits := range map[string][]Edit{
+		"out of the content": {{Start: 20, End: 30}},
+		"negative":           {{Start: -1, End: 2}},
+		"reversed":           {{Start: 5, End: 2}},
+		"overlapping":        {{Start: 0, End: 5}, {Start: 3, End: 6}},
+		"unsorted":           {{Start: 6, End: 8}, {Start: 0, End: 2}},
+	} {
+		if _, err := ApplyEdits(content, edits); err == nil {
+			t.Errorf("Expected an error for edits %s, but got none", name)
+		}
+	}
+}
+
+func TestParseImagePolicy(t *testing.T) {
+	for name, expected := range map[string]ImagePolicy{"": ImagesReference, "reference": ImagesReference, "inline": ImagesInline, "skip": ImagesSkip} {
+		if policy, err := ParseImagePolicy(name); err != nil || policy != expected {
+			t.Errorf("Expected %q to be parsed as %q, but got %q (%v)", name, expected, policy, err)
+		}
+	}
+	if _, err := ParseImagePolicy("remove"); err == nil {
+		t.Errorf("Expected an error for an unknown policy")
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
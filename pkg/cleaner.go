@@ -3,37 +3,393 @@ package converter
 import (
 	"bytes"
 	"fmt"
-	"regexp"
-	"unicode"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
+// cleanup removes all definitions from the content and replaces inline links
+// with a reference to the link with the same URL and title, reusing existing
+// labels. Code, HTML and math blocks and code spans are left untouched.
 func cleanup(links []Link, content []byte) []byte {
-	refLinkRegex := regexp.MustCompile(`[^\]]\[((\w+)|(\^\w+))\]:\s(.+)`)
-	content = refLinkRegex.ReplaceAll(content, []byte(""))
+	c := MarkdownConverter{Links: links}
+	return c.cleanupDocument(parseDocument(content))
+}
+
+// cleanupDocument does what cleanup does with the links of the converter,
+// handling images and autolinks according to its options
+func (c *MarkdownConverter) cleanupDocument(doc *document) []byte {
+	return applyEdits(doc.source, tidyEdits(doc.source, c.cleanupEdits(doc)))
+}
+
+// cleanupEdits returns the edits removing the definitions and rewriting the
+// links of the document
+func (c *MarkdownConverter) cleanupEdits(doc *document) []edit {
+	content := doc.source
+	links := c.Links
+	images := c.options.Images
+
+	ids := make(map[linkKey]string)
+	imageLinks := make(map[string]Link)
 	for _, link := range links {
-		if link.IsFootnote() || link.IsReference() {
-			content = removeLineContainingString(content, link.AsReference())
-		} else {
-			linkRef := fmt.Sprintf("[%s]", link.ID)
-			linkRegex := regexp.MustCompile(fmt.Sprintf(`\(%s\)`, link.URL))
-			content = linkRegex.ReplaceAll(content, []byte(linkRef))
+		if link.IsFootnote() || link.URL == "" {
+			continue
+		}
+		if _, ok := ids[keyOf(link)]; !ok {
+			ids[keyOf(link)] = link.ID
+		}
+		if link.Image {
+			imageLinks[normalizeLabel(link.ID)] = link
+		}
+	}
+
+	var edits []edit
+	for _, d := range doc.definitions {
+		edits = append(edits, removeDefinition(doc, d, func(definition) bool { return true }))
+	}
+	for _, s := range doc.indents {
+		edits = append(edits, edit{span: s})
+	}
+	for _, l := range doc.links {
+		if id, ok := c.footnotes.labels[normalizeLabel(l.label)]; ok && l.kind == footnoteReference && id != l.label {
+			edits = append(edits, edit{span: l.span, replacement: "[" + id + "]"})
+			continue
+		}
+		if l.image && images == ImagesInline && l.isReference() {
+			// Definitions shared with links stay, and are renumbered
+			if link, ok := imageLinks[normalizeLabel(l.label)]; ok {
+				link.Name = string(content[l.text.start:l.text.end])
+				edits = append(edits, edit{span: l.span, replacement: inlineLinkText(link, true)})
+				continue
+			}
+		}
+		if id, ok := c.renumbered[normalizeLabel(l.label)]; ok && l.isReference() && id != l.label {
+			edits = append(edits, edit{span: span{l.text.end + 1, l.end}, replacement: fmt.Sprintf("[%s]", id)})
+			continue
+		}
+		if !c.convertsLink(doc, l) {
+			continue
+		}
+		if id, ok := ids[linkKey{l.destination, l.title, l.image}]; ok {
+			edits = append(edits, edit{span: span{l.text.end + 1, l.end}, replacement: fmt.Sprintf("[%s]", id)})
+		}
+	}
+	for _, a := range doc.autolinks {
+		switch c.options.Autolinks {
+		case AutolinksReference:
+			if id, ok := ids[linkKey{url: a.url}]; ok && !staysAutolink(doc, a.start) {
+				edits = append(edits, edit{span: a.span, replacement: fmt.Sprintf("[%s][%s]", c.autolinkText(a.url), id)})
+			}
+		case AutolinksNormalize:
+			// In angle brackets, the URL could make a definition of the line
+			if a.bare && !followsLabel(content, a.start) && !staysAutolink(doc, a.start) {
+				edits = append(edits, edit{span: a.span, replacement: "<" + a.url + ">"})
+			}
+		}
+	}
+	return c.moveFootnoteEdits(doc, edits)
+}
+
+// removeDefinition returns the edit removing the definition. A definition
+// ending a list is replaced by an empty HTML comment, which still ends it,
+// if indented lines follow, as these would go on the list without it. One
+// between lines that would make a definition once together, like a label
+// and a destination, is replaced by an empty line keeping them apart. The
+// lines around it are the ones left once the definitions next to it that
+// are removed too are gone.
+func removeDefinition(doc *document, d definition, removed func(definition) bool) edit {
+	src := doc.source
+	if d.endsList {
+		// The definitions following it are removed too
+		for pos := d.end; pos < len(src); {
+			next := lineEnd(src, pos)
+			if i := sort.Search(len(doc.definitions), func(i int) bool { return doc.definitions[i].start >= pos }); i < len(doc.definitions) && doc.definitions[i].start == pos {
+				next = doc.definitions[i].end
+			} else if line := trimLineEnding(src[pos:next]); !isBlank(line) {
+				if indent, _ := leadingIndent(line); indent > 0 {
+					return edit{span: d.span, replacement: "<!-- -->\n"}
+				}
+				break
+			}
+			pos = next
+		}
+	}
+	start, end := d.start, d.end
+	for i := sort.Search(len(doc.definitions), func(i int) bool { return doc.definitions[i].start >= start }); i > 0 && doc.definitions[i-1].end == start && removed(doc.definitions[i-1]); i-- {
+		start = doc.definitions[i-1].start
+	}
+	for i := sort.Search(len(doc.definitions), func(i int) bool { return doc.definitions[i].start >= end }); i < len(doc.definitions) && doc.definitions[i].start == end && removed(doc.definitions[i]); i++ {
+		end = doc.definitions[i].end
+	}
+	// Only the first of the definitions removed together keeps them apart
+	if start != d.start || start == 0 || end == len(src) {
+		return edit{span: d.span}
+	}
+	first := trimLineEnding(src[d.start:lineEnd(src, d.start)])
+	_, line := quoteMarkers(first)
+	previousQuotes, previous := quoteMarkers(trimLineEnding(src[lineStart(src, start-1):start]))
+	nextQuotes, next := quoteMarkers(trimLineEnding(src[end:lineEnd(src, end)]))
+	if _, n, ok := parseDefinitionLines([][]byte{previous, next}); ok && n == 2 && previousQuotes == nextQuotes {
+		// The empty line is within the same blockquotes
+		return edit{span: d.span, replacement: string(bytes.TrimRight(first[:len(first)-len(line)], " ")) + "\n"}
+	}
+	return edit{span: d.span}
+}
+
+// opensDestination tells if the text at pos is within parentheses opened
+// right after a link, in the same paragraph, like a link destination. The
+// link it holds is left as it is, as the destination may only be valid once
+// the link is rewritten.
+func (d *document) opensDestination(pos int) bool {
+	i := sort.Search(len(d.destinations), func(i int) bool { return d.destinations[i].end > pos })
+	return i < len(d.destinations) && d.destinations[i].start <= pos
+}
+
+// staysAutolink tells if the autolink at pos must be left as it is: within
+// a destination, or after a bracket, which would make a link of the text
+// before it
+func staysAutolink(doc *document, pos int) bool {
+	return (pos > 0 && doc.source[pos-1] == ']') || doc.opensDestination(pos)
+}
+
+// followsLabel tells if the text before pos, on its line or on the line
+// before if there is none, ends with a colon right after a bracket, as the
+// label of a definition does. A parenthesis or an angle bracket may become
+// a bracket once the link they close is rewritten.
+func followsLabel(content []byte, pos int) bool {
+	start := bytes.LastIndexByte(content[:pos], '\n') + 1
+	text := bytes.TrimRight(content[start:pos], " \t")
+	if len(bytes.TrimLeft(text, " \t")) == 0 && start > 0 {
+		previous := bytes.LastIndexByte(content[:start-1], '\n') + 1
+		text = bytes.TrimRight(content[previous:start-1], " \t\r")
+	}
+	n := len(text)
+	return n >= 2 && text[n-1] == ':' && (text[n-2] == ']' || text[n-2] == ')' || text[n-2] == '>')
+}
+
+// tidyEdits returns the edits to make to the content in place of the given
+// ones, so that the blank lines left behind by removed definitions, or
+// brought by inserted ones, don't pile up. Only the blank lines around the
+// edits adding or removing lines are collapsed, and removed at the end of
+// the document, the rest of it is left as it is. The inserted text takes
+// the line endings of the document. The edits returned are sorted, don't
+// overlap and only span the bytes they change.
+func tidyEdits(content []byte, edits []edit) []edit {
+	eol := lineEnding(content)
+	sortEdits(edits)
+
+	var groups []editGroup
+	for i := range edits {
+		edits[i].replacement = withLineEnding(edits[i].replacement, eol)
+		e := edits[i]
+		g := editGroup{span: e.span, edits: edits[i : i+1]}
+		if changesLines(content, e) {
+			g.span, g.tidy = aroundLines(content, e.span), true
+		}
+		// Edits are grouped with the ones whose lines they share
+		for len(groups) > 0 && groups[len(groups)-1].end >= g.start {
+			g = groups[len(groups)-1].merge(content, g)
+			groups = groups[:len(groups)-1]
+		}
+		groups = append(groups, g)
+	}
+
+	tidied := make([]edit, 0, len(groups))
+	for _, g := range groups {
+		shifted := make([]edit, 0, len(g.edits))
+		for _, e := range g.edits {
+			shifted = append(shifted, edit{span: span{e.start - g.start, e.end - g.start}, replacement: e.replacement})
+		}
+		text := string(applyEdits(content[g.start:g.end], shifted))
+		if g.tidy {
+			text = collapseBlankLines(text, eol, g.end == len(content))
+		}
+		if e, changed := trimEdit(content, edit{span: g.span, replacement: text}); changed {
+			tidied = append(tidied, e)
 		}
 	}
+	return tidied
+}
+
+// trimEdit narrows the edit down to the bytes it changes, leaving out the
+// text at its start and at its end that stays the same, without splitting
+// characters. It returns false if the edit changes nothing.
+func trimEdit(content []byte, e edit) (edit, bool) {
+	old, text := content[e.start:e.end], e.replacement
+	prefix := 0
+	for prefix < len(old) && prefix < len(text) && old[prefix] == text[prefix] {
+		prefix++
+	}
+	if prefix == len(old) && prefix == len(text) {
+		return e, false
+	}
+	for prefix > 0 && ((prefix < len(old) && !utf8.RuneStart(old[prefix])) || (prefix < len(text) && !utf8.RuneStart(text[prefix]))) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(text)-prefix && old[len(old)-1-suffix] == text[len(text)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && (!utf8.RuneStart(old[len(old)-suffix]) || !utf8.RuneStart(text[len(text)-suffix])) {
+		suffix--
+	}
+	return edit{span: span{e.start + prefix, e.end - suffix}, replacement: text[prefix : len(text)-suffix]}, true
+}
+
+// changesLines tells if the edit adds or removes lines, or empties the
+// line it is on
+func changesLines(content []byte, e edit) bool {
+	if strings.Count(e.replacement, "\n") != bytes.Count(content[e.start:e.end], []byte("\n")) {
+		return true
+	}
+	return e.start < e.end && isBlank([]byte(e.replacement)) && isBlank(content[lineStart(content, e.start):e.start]) && isBlank(content[e.end:lineEnd(content, e.end)])
+}
+
+// editGroup is a span of the content changed by one or more edits
+type editGroup struct {
+	span
+	// edits is a run of the sorted edits, sharing their backing array
+	edits []edit
+	// tidy is true if the edits add or remove lines, and the blank lines
+	// of the group are to be collapsed
+	tidy bool
+}
+
+// merge returns the group made of the edits of both groups, the other one
+// following this one. The edits of the other group come right after the
+// ones of this group in the backing array, which is only resliced.
+func (g editGroup) merge(content []byte, other editGroup) editGroup {
+	merged := editGroup{span: g.span, edits: g.edits[:len(g.edits)+len(other.edits)], tidy: g.tidy || other.tidy}
+	// The span of a group to tidy already holds whole lines, so it is
+	// only extended if one of its ends comes from the other kind of group
+	startsLines, endsLines := g.tidy, g.tidy
+	if other.start < merged.start {
+		merged.start, startsLines = other.start, other.tidy
+	}
+	if other.end > merged.end {
+		merged.end, endsLines = other.end, other.tidy
+	}
+	if merged.tidy && (!startsLines || !endsLines) {
+		merged.span = aroundLines(content, merged.span)
+	}
+	return merged
+}
+
+// aroundLines returns the span of the lines holding the given span, along
+// with the blank lines before and after them
+func aroundLines(content []byte, s span) span {
+	first := textStart(content)
+	start := lineStart(content, s.start)
+	for start > first {
+		previous := lineStart(content, start-1)
+		if !isBlank(content[previous:start]) {
+			break
+		}
+		start = previous
+	}
+	end := s.end
+	if end > first && content[end-1] != '\n' {
+		end = lineEnd(content, end)
+	}
+	for end < len(content) {
+		next := lineEnd(content, end)
+		if !isBlank(content[end:next]) {
+			break
+		}
+		end = next
+	}
+	return span{start, end}
+}
+
+// collapseBlankLines keeps only the first of the blank lines following each
+// other in the text, which starts a line, as an empty line, and removes the
+// last ones if the text ends the document
+func collapseBlankLines(text, eol string, atEnd bool) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		switch {
+		case line == "":
+		case !isBlank([]byte(line)):
+			lines = append(lines, line)
+			blank = false
+		case !blank:
+			lines = append(lines, eol)
+			blank = true
+		}
+	}
+	for atEnd && len(lines) > 0 && isBlank([]byte(lines[len(lines)-1])) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "")
+}
+
+// lineEnding returns the line ending of most lines of the content, "\r\n"
+// or, by default, "\n". A single line ending with a carriage return would
+// end with "\r\n" once a line feed is added.
+func lineEnding(content []byte) string {
+	lines := bytes.Count(content, []byte("\n"))
+	crlf := bytes.Count(content, []byte("\r\n"))
+	if crlf > lines-crlf || (lines == 0 && bytes.HasSuffix(content, []byte("\r"))) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// withLineEnding returns the text with the line ending in place of its
+// line feeds
+func withLineEnding(text, eol string) string {
+	if eol == "\n" || !strings.Contains(text, "\n") {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' && (i == 0 || text[i-1] != '\r') {
+			b.WriteString(eol[:len(eol)-1])
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+// edit replaces a span of the content with a new text
+type edit struct {
+	span
+	replacement string
+}
+
+// applyEdits returns a copy of the content with the given edits applied.
+// Edits must not overlap.
+func applyEdits(content []byte, edits []edit) []byte {
+	sortEdits(edits)
+
+	var output bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		output.Write(content[last:e.start])
+		output.WriteString(e.replacement)
+		last = e.end
+	}
+	output.Write(content[last:])
+	return output.Bytes()
+}
 
-	// Remove all empty lines if there is more than one in a row
-	content = regexp.MustCompile(`(\n){3,}`).ReplaceAll(content, []byte("\n\n"))
-	// // Remove the last line if it's empty
-	content = bytes.TrimRightFunc(content, unicode.IsSpace)
-	return content
+// sortEdits sorts the edits by position, insertions going before the edits
+// starting at the same position
+func sortEdits(edits []edit) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start || (edits[i].start == edits[j].start && edits[i].end < edits[j].end)
+	})
 }
 
 func removeLineContainingString(buffer []byte, str string) []byte {
-	lines := bytes.Split(buffer, []byte("\n"))
+	// Lines keep their line endings, whichever these are
+	lines := bytes.SplitAfter(buffer, []byte("\n"))
 	var newLines [][]byte
 	for _, line := range lines {
 		if !bytes.Contains(line, []byte(str)) {
 			newLines = append(newLines, line)
 		}
 	}
-	return bytes.Join(newLines, []byte("\n"))
+	return bytes.Join(newLines, nil)
 }
@@ -15,7 +15,7 @@ func TestCleanup(t *testing.T) {
 		content := []byte(`This is some text with a reference [link][1].
     [1]: https://www.example1.com`)
 
-		expectedOutput := []byte(`This is some text with a reference [link][1].`)
+		expectedOutput := []byte("This is some text with a reference [link][1].\n")
 
 		output := cleanup(links, content)
 
@@ -36,19 +36,55 @@ func TestCleanup(t *testing.T) {
 
 	})
 
-	t.Run("removes duplicated empty lines", func(t *testing.T) {
-		links := []Link{}
-		content := []byte(`This is some text with an empty line.
+	t.Run("removes the empty lines left by removed definitions", func(t *testing.T) {
+		links := []Link{{ID: "1", URL: "https://www.example1.com"}}
+		content := []byte(`This is some text with a [link][1].
+
+[1]: https://www.example1.com
 
 
 This is some more text.`)
 
-		expectedOutput := []byte(`This is some text with an empty line.
+		expectedOutput := []byte(`This is some text with a [link][1].
 
 This is some more text.`)
 
 		output := cleanup(links, content)
 
+		compareResults(output, expectedOutput, t)
+	})
+
+	t.Run("keeps the blockquote lines next to removed definitions", func(t *testing.T) {
+		content := []byte("text\n\n[1]: http://a\n>\n    [1]\n")
+
+		expectedOutput := []byte("text\n\n>\n    [1]\n")
+
+		output := cleanup([]Link{}, content)
+
+		compareResults(output, expectedOutput, t)
+	})
+
+	t.Run("keeps apart the lines around definitions removed together", func(t *testing.T) {
+		content := []byte("[0]:\n[a]: http://a\n[b]: http://b\nhttp://c\n")
+
+		expectedOutput := []byte("[0]:\n\nhttp://c\n")
+
+		output := cleanup([]Link{}, content)
+
+		compareResults(output, expectedOutput, t)
+	})
+
+	t.Run("keeps the empty lines away from the changes", func(t *testing.T) {
+		links := []Link{}
+		content := []byte(`This is some text with empty lines.
+
+
+This is some more text.`)
+
+		expectedOutput := content
+
+		output := cleanup(links, content)
+
 		compareResults(output, expectedOutput, t)
 
 	})
@@ -78,7 +114,7 @@ This is some more text.`)
 		content := []byte(`This is some text with a footnote link[^1].
 [^1]: https://www.example1.com`)
 
-		expectedOutput := []byte(`This is some text with a footnote link[^1].`)
+		expectedOutput := []byte("This is some text with a footnote link[^1].\n")
 
 		output := cleanup(links, content)
 
@@ -124,7 +160,8 @@ This is some more text.`)
 [Third link](https://www.example3.com)
 [Fourth link](https://www.example4.com)
 [Invalid Link]
-[Example page][Example]`)
+[Example page][Example]
+`)
 
 		links := []Link{}
 		output := cleanup(links, content)
@@ -133,6 +170,33 @@ This is some more text.`)
 	})
 }
 
+func TestCleanupLeavesCodeUntouched(t *testing.T) {
+	links := []Link{{ID: "1", URL: "https://example.com"}}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"fenced code block", "```sh\ncurl [docs](https://example.com)\n[1]: https://example.com\n```"},
+		{"indented code block", "    curl [docs](https://example.com)\n\n    [1]: https://example.com"},
+		{"code span", "Run `curl [docs](https://example.com)` first."},
+		{"HTML block", "<div>\n<a href=\"#\">[docs](https://example.com)</a>\n[1]: https://example.com\n</div>"},
+		{"HTML comment", "<!--\n[docs](https://example.com)\n\n[1]: https://example.com\n-->"},
+		{"math block", "$$\nf[x](https://example.com)\n[1]: https://example.com\n$$"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := []byte("See [docs](https://example.com).\n\n" + test.code + "\n\nSee [docs](https://example.com).\n\n[1]: https://example.com")
+			expectedOutput := []byte("See [docs][1].\n\n" + test.code + "\n\nSee [docs][1].\n")
+
+			output := cleanup(links, content)
+
+			compareResults(output, expectedOutput, t)
+		})
+	}
+}
+
 func TestRemoveLineContainingString(t *testing.T) {
 	content := []byte(`
 		This is a test file.
@@ -159,3 +223,33 @@ func compareResults(output []byte, expectedOutput []byte, t *testing.T) {
 		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
 	}
 }
+
+func TestRemoveLineContainingStringKeepsLineEndings(t *testing.T) {
+	content := []byte("first line\r\nthis is a test\r\nlast line\r\n")
+
+	compareResults(removeLineContainingString(content, "test"), []byte("first line\r\nlast line\r\n"), t)
+}
+
+func TestTrimEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		edit     edit
+		expected edit
+		changed  bool
+	}{
+		{"keeps what stays the same", "[a](b) c", edit{span{0, 8}, "[a][1] c"}, edit{span{3, 6}, "[1]"}, true},
+		{"doesn't split characters", "żółw é", edit{span{0, 9}, "żołw è"}, edit{span{2, 9}, "ołw è"}, true},
+		{"inserts text", "a\n", edit{span{0, 2}, "a\n\n[1]: b\n"}, edit{span{2, 2}, "\n[1]: b\n"}, true},
+		{"changes nothing", "a\n", edit{span{0, 2}, "a\n"}, edit{span{0, 2}, "a\n"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trimmed, changed := trimEdit([]byte(test.content), test.edit)
+			if changed != test.changed || (changed && trimmed != test.expected) {
+				t.Errorf("Expected %+v (%t), but got %+v (%t)", test.expected, test.changed, trimmed, changed)
+			}
+		})
+	}
+}
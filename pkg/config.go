@@ -0,0 +1,315 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the configuration files, looked for in the
+// directory of every processed file and in its parents
+const ConfigFileName = ".markdown-tools.yaml"
+
+// Config holds the settings of a configuration file. Settings left out are
+// taken from the configuration files of the parent directories, the closer
+// a file is to the processed one, the stronger its settings.
+type Config struct {
+	// Root stops the search for configuration files in parent directories
+	Root bool `yaml:"root,omitempty"`
+	// IDs is how the IDs of new references are chosen
+	IDs IDStrategy `yaml:"ids,omitempty"`
+	// Placement is where the definitions go
+	Placement Placement `yaml:"placement,omitempty"`
+	// SectionLevel is the level of the headings ending the sections with
+	// PlacementSection
+	SectionLevel *int `yaml:"section-level,omitempty"`
+	// Images is what happens to images
+	Images ImagePolicy `yaml:"images,omitempty"`
+	// Autolinks is what happens to autolinks and bare URLs
+	Autolinks AutolinkPolicy `yaml:"autolinks,omitempty"`
+	// Footnotes is what happens to footnotes
+	Footnotes FootnotePolicy `yaml:"footnotes,omitempty"`
+	// Renumber gives the references with numeric IDs new numbers
+	Renumber *bool `yaml:"renumber,omitempty"`
+	// Backup creates a .bak copy of every file before updating it
+	Backup *bool `yaml:"backup,omitempty"`
+	// Include limits the processed files to those matching one of the
+	// glob patterns, relative to the directory of the configuration file
+	Include []string `yaml:"include,omitempty"`
+	// Exclude skips the files and directories matching one of the glob
+	// patterns, relative to the directory of the configuration file, besides
+	// the ones skipped by FileOptions.Exclude
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Overrides are the settings of the files in the given directories,
+	// relative to the directory of the configuration file. They take
+	// precedence over the other settings of the file, the deeper the
+	// directory, the stronger.
+	Overrides map[string]Config `yaml:"overrides,omitempty"`
+	// Sources are the configuration files the settings were read from,
+	// from the farthest to the closest
+	Sources []string `yaml:"-"`
+
+	// includeDir and excludeDir are the directories the patterns are
+	// relative to
+	includeDir string
+	excludeDir string
+}
+
+// DefaultConfig returns the settings used when no configuration file or
+// flag sets them
+func DefaultConfig() Config {
+	sectionLevel := 0
+	renumber, backup := false, false
+	return Config{
+		IDs:          IDsNumeric,
+		Placement:    PlacementEnd,
+		SectionLevel: &sectionLevel,
+		Images:       ImagesReference,
+		Autolinks:    AutolinksKeep,
+		Footnotes:    FootnotesKeep,
+		Renumber:     &renumber,
+		Backup:       &backup,
+	}
+}
+
+// FindConfig returns the settings of the configuration files found from the
+// given file or directory upwards, merged
+func FindConfig(path string) (Config, error) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	return newConfigFinder().find(dir)
+}
+
+// Merge returns the settings of c with the ones set in other replacing them
+func (c Config) Merge(other Config) Config {
+	if other.IDs != "" {
+		c.IDs = other.IDs
+	}
+	if other.Placement != "" {
+		c.Placement = other.Placement
+	}
+	if other.SectionLevel != nil {
+		c.SectionLevel = other.SectionLevel
+	}
+	if other.Images != "" {
+		c.Images = other.Images
+	}
+	if other.Autolinks != "" {
+		c.Autolinks = other.Autolinks
+	}
+	if other.Footnotes != "" {
+		c.Footnotes = other.Footnotes
+	}
+	if other.Renumber != nil {
+		c.Renumber = other.Renumber
+	}
+	if other.Backup != nil {
+		c.Backup = other.Backup
+	}
+	if other.Include != nil {
+		c.Include, c.includeDir = other.Include, other.includeDir
+	}
+	if other.Exclude != nil {
+		c.Exclude, c.excludeDir = other.Exclude, other.excludeDir
+	}
+	c.Sources = append(append([]string(nil), c.Sources...), other.Sources...)
+	c.Root, c.Overrides = false, nil
+	return c
+}
+
+// Apply returns the options with the settings of the configuration
+func (c Config) Apply(options FileOptions) FileOptions {
+	options.Conversion = c.applyConversion(options.Conversion)
+	if c.Backup != nil {
+		options.Backup = *c.Backup
+	}
+	return options
+}
+
+// applyConversion returns the conversion options with the settings of the
+// configuration
+func (c Config) applyConversion(options Options) Options {
+	if c.IDs != "" {
+		options.IDs = c.IDs
+	}
+	if c.Placement != "" {
+		options.Placement = c.Placement
+	}
+	if c.SectionLevel != nil {
+		options.SectionLevel = *c.SectionLevel
+	}
+	if c.Images != "" {
+		options.Images = c.Images
+	}
+	if c.Autolinks != "" {
+		options.Autolinks = c.Autolinks
+	}
+	if c.Footnotes != "" {
+		options.Footnotes = c.Footnotes
+	}
+	if c.Renumber != nil {
+		options.Renumber = *c.Renumber
+	}
+	return options
+}
+
+// accepts tells if the patterns of the configuration let the file or
+// directory be processed
+func (c Config) accepts(name string, isDir bool) bool {
+	if !isDir && c.Include != nil && !matchesAny(c.Include, relativeTo(c.includeDir, name)) {
+		return false
+	}
+	return !matchesAny(c.Exclude, relativeTo(c.excludeDir, name))
+}
+
+// validate checks the values of the settings, including the overrides
+func (c Config) validate() error {
+	if _, err := ParseIDStrategy(string(c.IDs)); err != nil {
+		return err
+	}
+	if _, err := ParsePlacement(string(c.Placement)); err != nil {
+		return err
+	}
+	if c.SectionLevel != nil && *c.SectionLevel < 0 {
+		return fmt.Errorf("section-level must not be negative, got %d", *c.SectionLevel)
+	}
+	if _, err := ParseImagePolicy(string(c.Images)); err != nil {
+		return err
+	}
+	if _, err := ParseAutolinkPolicy(string(c.Autolinks)); err != nil {
+		return err
+	}
+	if _, err := ParseFootnotePolicy(string(c.Footnotes)); err != nil {
+		return err
+	}
+	for dir, override := range c.Overrides {
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("overrides of %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// configFinder reads the configuration files and remembers the settings
+// found for every directory
+type configFinder struct {
+	files map[string]*Config
+	dirs  map[string]Config
+}
+
+func newConfigFinder() *configFinder {
+	return &configFinder{files: make(map[string]*Config), dirs: make(map[string]Config)}
+}
+
+// find returns the settings of the files in the directory
+func (f *configFinder) find(dir string) (Config, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return Config{}, err
+	}
+	if config, ok := f.dirs[absDir]; ok {
+		return config, nil
+	}
+
+	// The directories holding a configuration file, from the closest
+	var dirs []string
+	for d := absDir; ; d = filepath.Dir(d) {
+		file, err := f.load(d)
+		if err != nil {
+			return Config{}, err
+		}
+		if file != nil {
+			dirs = append(dirs, d)
+			if file.Root {
+				break
+			}
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+
+	var config Config
+	for i := len(dirs) - 1; i >= 0; i-- {
+		file := f.files[dirs[i]]
+		config = config.Merge(*file)
+
+		var overrides []string
+		for name := range file.Overrides {
+			if isWithin(filepath.Join(dirs[i], name), absDir) {
+				overrides = append(overrides, name)
+			}
+		}
+		sort.Slice(overrides, func(a, b int) bool {
+			return len(filepath.Clean(overrides[a])) < len(filepath.Clean(overrides[b]))
+		})
+		for _, name := range overrides {
+			override := file.Overrides[name]
+			override.includeDir = filepath.Join(dirs[i], name)
+			override.excludeDir = override.includeDir
+			config = config.Merge(override)
+		}
+	}
+	f.dirs[absDir] = config
+	return config, nil
+}
+
+// load reads the configuration file in the directory, if there is one
+func (f *configFinder) load(dir string) (*Config, error) {
+	if file, ok := f.files[dir]; ok {
+		return file, nil
+	}
+
+	name := filepath.Join(dir, ConfigFileName)
+	content, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		f.files[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	// Unknown keys are reported, for a typo not to be silently ignored
+	file := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	file.includeDir, file.excludeDir = dir, dir
+	file.Sources = []string{name}
+	f.files[dir] = file
+	return file, nil
+}
+
+// isWithin tells if the path is the directory or is in it
+func isWithin(dir, path string) bool {
+	relativePath, err := filepath.Rel(dir, path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// relativeTo returns the slash-separated path relative to the directory
+func relativeTo(dir, name string) string {
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	relativePath, err := filepath.Rel(dir, absName)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	return filepath.ToSlash(relativePath)
+}
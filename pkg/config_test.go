@@ -0,0 +1,148 @@
+package converter
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, ConfigFileName), []byte("ids: hash\nbackup: true\n"))
+	writeTestFile(t, filepath.Join(dir, "project", ConfigFileName), []byte(`root: true
+ids: slug
+placement: section
+exclude: [drafts]
+overrides:
+  docs:
+    placement: markers
+  docs/api:
+    placement: end
+    section-level: 2
+`))
+	writeTestFile(t, filepath.Join(dir, "project", "docs", ConfigFileName), []byte("ids: domain\nrenumber: true\n"))
+
+	t.Run("merges the files from the root", func(t *testing.T) {
+		config, err := FindConfig(filepath.Join(dir, "project", "docs", "api", "guide"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		if config.IDs != IDsDomain {
+			t.Errorf("Expected the closest file to set the IDs, but got %q", config.IDs)
+		}
+		if config.Placement != PlacementEnd || config.SectionLevel == nil || *config.SectionLevel != 2 {
+			t.Errorf("Expected the deepest override to set the placement, but got %q", config.Placement)
+		}
+		if config.Renumber == nil || !*config.Renumber {
+			t.Errorf("Expected renumbering to be set, but got %v", config.Renumber)
+		}
+		if config.Backup != nil {
+			t.Errorf("Expected files above the root one to be ignored, but got backup %v", *config.Backup)
+		}
+		expected := []string{filepath.Join(dir, "project", ConfigFileName), filepath.Join(dir, "project", "docs", ConfigFileName)}
+		if !reflect.DeepEqual(config.Sources, expected) {
+			t.Errorf("Expected the sources %v, but got %v", expected, config.Sources)
+		}
+	})
+
+	t.Run("uses the overrides of the directory", func(t *testing.T) {
+		config, err := FindConfig(filepath.Join(dir, "project", "docs"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if config.Placement != PlacementMarkers {
+			t.Errorf("Expected the override to set the placement, but got %q", config.Placement)
+		}
+	})
+
+	t.Run("reports invalid settings", func(t *testing.T) {
+		writeTestFile(t, filepath.Join(dir, "broken", ConfigFileName), []byte("overrides:\n  docs:\n    images: none\n"))
+
+		_, err := FindConfig(filepath.Join(dir, "broken", "docs"))
+		if err == nil || !strings.Contains(err.Error(), `unknown image policy "none"`) {
+			t.Errorf("Expected an error about the image policy, but got %v", err)
+		}
+	})
+
+	t.Run("reports unknown settings", func(t *testing.T) {
+		name := filepath.Join(dir, "typo", ConfigFileName)
+		writeTestFile(t, name, []byte("idz: slug\n"))
+
+		_, err := FindConfig(filepath.Join(dir, "typo"))
+		if err == nil || !strings.Contains(err.Error(), name) || !strings.Contains(err.Error(), "field idz not found") {
+			t.Errorf("Expected an error about the unknown setting in %s, but got %v", name, err)
+		}
+	})
+
+	t.Run("accepts empty files", func(t *testing.T) {
+		writeTestFile(t, filepath.Join(dir, "empty", ConfigFileName), nil)
+
+		if _, err := FindConfig(filepath.Join(dir, "empty")); err != nil {
+			t.Errorf("Expected no error, but got %v", err)
+		}
+	})
+}
+
+func TestConvertFilesInPathsConfig(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("[Go](https://go.dev)\n")
+	writeTestFile(t, filepath.Join(dir, ConfigFileName), []byte("root: true\nids: slug\nexclude: [docs/drafts]\n"))
+	writeTestFile(t, filepath.Join(dir, "docs", ConfigFileName), []byte("ids: domain\n"))
+	writeTestFile(t, filepath.Join(dir, "README.md"), content)
+	writeTestFile(t, filepath.Join(dir, "docs", "guide.md"), content)
+	writeTestFile(t, filepath.Join(dir, "docs", "drafts", "draft.md"), content)
+
+	tests := []struct {
+		name      string
+		config    *Config
+		processed int
+		expected  map[string]string
+	}{
+		{
+			name:      "ignores the configuration files by default",
+			config:    nil,
+			processed: 3,
+			expected: map[string]string{
+				"README.md":            "[Go][1]\n\n[1]: https://go.dev\n",
+				"docs/guide.md":        "[Go][1]\n\n[1]: https://go.dev\n",
+				"docs/drafts/draft.md": "[Go][1]\n\n[1]: https://go.dev\n",
+			},
+		},
+		{
+			name:      "uses the configuration files",
+			config:    &Config{},
+			processed: 2,
+			expected: map[string]string{
+				"README.md":     "[Go][go]\n\n[go]: https://go.dev\n",
+				"docs/guide.md": "[Go][go-dev-1]\n\n[go-dev-1]: https://go.dev\n",
+			},
+		},
+		{
+			name:      "gives precedence to the given settings",
+			config:    &Config{IDs: IDsHash},
+			processed: 2,
+			expected: map[string]string{
+				"README.md":     "[Go][6e7f58f]\n\n[6e7f58f]: https://go.dev\n",
+				"docs/guide.md": "[Go][6e7f58f]\n\n[6e7f58f]: https://go.dev\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := t.TempDir()
+			summary, err := ConvertFilesInPaths([]string{dir}, FileOptions{OutputDir: output, Config: test.config})
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if summary.Processed != test.processed {
+				t.Errorf("Expected %d processed files, but got %d", test.processed, summary.Processed)
+			}
+			for name, expected := range test.expected {
+				compareResults(readTestFile(t, filepath.Join(output, name)), []byte(expected), t)
+			}
+		})
+	}
+}
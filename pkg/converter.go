@@ -2,13 +2,9 @@ package converter
 
 import (
 	"bytes"
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"path/filepath"
-	"regexp"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 // Link represents a link along with its reference number
@@ -18,173 +14,317 @@ type MarkdownConverter struct {
 	originalContent []byte
 	modifiedContent []byte
 	Links           []Link
+	index           *linkIndex
+	options         Options
+	// autolinkTexts caches the text of the links made from autolinks
+	autolinkTexts map[string]string
+	// renumbered holds the new IDs of the renumbered links by previous ID
+	renumbered map[string]string
+	footnotes  footnoteNumbers
+	// bracketed are the texts in brackets of the document, which new
+	// references must not use as IDs
+	bracketed []string
+	// edits turn the original content into the modified one
+	edits []edit
 }
 
-func (c *MarkdownConverter) extractFootnotesFromBuffer(content []byte) {
-	footnoteRegex := regexp.MustCompile(`\[(\^\d+)\]:\s(.+)`)
-	matches := footnoteRegex.FindAllSubmatch(content, -1)
+// linkIndex keeps track of the URLs, IDs and numbers used by the links,
+// so that adding a link doesn't require going through all the others
+type linkIndex struct {
+	size    int
+	urls    map[linkKey]bool
+	ids     map[string]int // normalized ID -> position of the first link using it
+	numbers map[int]bool
+	// taken are the normalized IDs that must not be given to new links
+	taken map[string]bool
+	// next is the lowest number that may be free, numbers are never released
+	next int
+}
 
-	for _, match := range matches {
-		c.addLink("", string(match[2]), string(match[1]))
+func (c *MarkdownConverter) buildIndex() *linkIndex {
+	if c.index != nil && c.index.size == len(c.Links) {
+		return c.index
+	}
+	c.index = &linkIndex{urls: make(map[linkKey]bool), ids: make(map[string]int), numbers: make(map[int]bool), taken: make(map[string]bool), next: 1}
+	for _, text := range c.bracketed {
+		c.index.taken[normalizeLabel(text)] = true
 	}
+	for i, link := range c.Links {
+		c.index.add(link, i)
+	}
+	return c.index
 }
-func (c *MarkdownConverter) extractMarkdownLinksFromBuffer(content []byte) {
-	refLinkRegex := regexp.MustCompile(`\[([^\]]*)?\]\[(\w+)\]`)
-	refLinksMatches := refLinkRegex.FindAllSubmatch(content, -1)
 
-	for _, match := range refLinksMatches {
-		c.addLink(string(match[1]), "", string(match[2]))
+func (x *linkIndex) add(link Link, position int) {
+	x.size++
+	if link.URL != "" && !link.IsFootnote() {
+		x.urls[keyOf(link)] = true
 	}
-
-	inlineLinkRegex := regexp.MustCompile(`\[(.*?)\]\((.*?)\)`)
-	inlineLinksMatches := inlineLinkRegex.FindAllSubmatch(content, -1)
-
-	for _, match := range inlineLinksMatches {
-		c.addLink(string(match[1]), string(match[2]), "")
+	id := normalizeLabel(link.ID)
+	if _, ok := x.ids[id]; !ok {
+		x.ids[id] = position
+	}
+	if num, err := strconv.Atoi(link.ID); err == nil {
+		x.numbers[num] = true
 	}
-
-	c.extractReferenceLinksFromBuffer(content)
-	c.extractFootnotesFromBuffer(content)
 }
-func (c *MarkdownConverter) extractReferenceLinksFromBuffer(content []byte) {
-	refLinkRegex := regexp.MustCompile(`\[(.*?)\]:\s(.+)`)
-	matches := refLinkRegex.FindAllSubmatch(content, -1)
 
-	for _, match := range matches {
-		matchID := string(match[1])
-		matchURL := string(match[2])
-
-		for i := range c.Links {
-			if c.Links[i].ID == matchID {
-				c.Links[i].URL = matchURL
-				break
-			}
+func (c *MarkdownConverter) extractFootnotesFromBuffer(doc *document) {
+	for _, d := range doc.definitions {
+		if d.isFootnote() {
+			c.addLink("", d.destination, d.label)
 		}
 	}
 }
 
-func (c *MarkdownConverter) addLink(name string, url string, ID string) {
-	if url != "" {
-		for _, link := range c.Links {
-			if link.URL == url {
-				return
-			}
+func (c *MarkdownConverter) extractMarkdownLinksFromBuffer(content []byte) {
+	c.extractMarkdownLinksFromDocument(parseDocument(content))
+}
+func (c *MarkdownConverter) extractMarkdownLinksFromDocument(doc *document) {
+	content := doc.source
+
+	for _, l := range doc.links {
+		if l.isReference() {
+			c.addLink(string(content[l.text.start:l.text.end]), "", l.label)
 		}
 	}
 
-	if ID != "" {
-		for _, link := range c.Links {
-			if link.ID == ID {
-				return
-			}
+	for _, l := range doc.links {
+		if c.convertsLink(doc, l) {
+			c.add(Link{Name: string(content[l.text.start:l.text.end]), URL: l.destination, Title: l.title, Image: l.image})
 		}
 	}
-	if ID == "" {
-		usedNumbers := make(map[int]bool)
-		for _, l := range c.Links {
-			if num, err := strconv.Atoi(l.ID); err == nil {
-				usedNumbers[num] = true
+
+	if c.options.Autolinks == AutolinksReference {
+		for _, a := range doc.autolinks {
+			if !staysAutolink(doc, a.start) {
+				c.add(Link{Name: c.autolinkText(a.url), URL: a.url})
 			}
 		}
-		nextNumber := 1
-		for usedNumbers[nextNumber] {
-			nextNumber++
-		}
-		ID = strconv.Itoa(nextNumber)
 	}
 
-	link := Link{Name: name, URL: url, ID: ID}
-	c.Links = append(c.Links, link)
+	c.extractReferenceLinksFromBuffer(doc)
+	c.extractFootnotesFromBuffer(doc)
 }
 
-func (c *MarkdownConverter) extractLinksFromReferences() {
-	refLinkRegex := regexp.MustCompile(`(\n|^)\s*\[(.*?)\]:\s(.+)`)
-	matches := refLinkRegex.FindAllSubmatch(c.originalContent, -1)
-
-	for _, match := range matches {
-		c.addLink(string(""), string(match[3]), string(match[2]))
+// convertsLink tells if the inline link is to be rewritten as a reference.
+// Links whose title takes several lines, which a definition cannot, and
+// links whose rewriting would change how the text around them is read are
+// left as they are.
+func (c *MarkdownConverter) convertsLink(doc *document, l linkNode) bool {
+	if l.kind != inlineLink || l.destination == "" || (l.image && !c.options.Images.convertsImages()) {
+		return false
 	}
+	// Brackets and backticks in the destination or the title could pair with
+	// the ones around the link
+	target := doc.source[l.text.end+1 : l.end]
+	return !strings.ContainsAny(l.title, "\r\n") && !bytes.ContainsAny(target, "[]`") && !doc.opensDestination(l.start)
 }
 
-func (c *MarkdownConverter) Run() {
-	c.modifiedContent = c.originalContent
-	c.extractLinksFromReferences()
-	c.extractMarkdownLinksFromBuffer(c.modifiedContent)
-	c.modifiedContent = cleanup(c.Links, c.modifiedContent)
-	c.modifiedContent = append(c.modifiedContent, "\n"...)
-	if len(c.Links) > 0 {
-		c.modifiedContent = append(c.modifiedContent, "\n"...)
-		c.modifiedContent = append(c.modifiedContent, []byte(BuildReferenceLinks(c.Links))...)
-		c.modifiedContent = append(c.modifiedContent, "\n"...)
+// autolinkText returns the text of the link made from an autolink: the text
+// given by Options.AutolinkText, the host of the URL or the URL itself
+func (c *MarkdownConverter) autolinkText(rawURL string) string {
+	if text, ok := c.autolinkTexts[rawURL]; ok {
+		return text
+	}
+	var text string
+	if c.options.AutolinkText != nil {
+		text = escapeLinkText(c.options.AutolinkText(rawURL))
+	}
+	if u, err := url.Parse(rawURL); text == "" && err == nil {
+		text = u.Hostname()
+	}
+	if text == "" {
+		text = escapeLinkText(rawURL)
 	}
+	if c.autolinkTexts == nil {
+		c.autolinkTexts = make(map[string]string)
+	}
+	c.autolinkTexts[rawURL] = text
+	return text
 }
 
-func setupLogger(verbose bool) {
-	log.SetOutput(io.Discard)
-	if verbose {
-		log.SetOutput(os.Stderr)
+func (c *MarkdownConverter) extractReferenceLinksFromBuffer(doc *document) {
+	index := c.buildIndex()
+	var images map[string]bool
+	if c.options.Images != ImagesSkip {
+		images = imageOnlyLabels(doc)
+	}
+	for _, d := range doc.definitions {
+		if i, ok := index.ids[normalizeLabel(d.label)]; ok && !d.isFootnote() && c.Links[i].URL == "" {
+			// The label is written as in the definition, whichever reference
+			// came first, and the definition is grouped with the images if
+			// only images use it
+			c.Links[i].ID, c.Links[i].URL, c.Links[i].Title = d.label, d.destination, d.title
+			c.Links[i].Image = images[normalizeLabel(d.label)]
+			index.urls[keyOf(c.Links[i])] = true
+		}
 	}
 }
-func ConvertFilesInPath(path string, backup, verbose bool) {
-	setupLogger(verbose)
 
-	filepath.WalkDir(path, func(path string, info os.DirEntry, err error) error {
-		if err != nil {
-			fmt.Printf("Error accessing file %s: %v\n", path, err)
-			return err
+func (c *MarkdownConverter) addLink(name string, url string, ID string) {
+	c.add(Link{Name: name, URL: url, ID: ID})
+}
+
+// add adds the link unless there already is one with the same URL and title
+// (footnotes can share their text) or the same ID. Links without an ID get
+// one following the ID strategy.
+func (c *MarkdownConverter) add(link Link) {
+	index := c.buildIndex()
+	if link.URL != "" && !link.IsFootnote() && index.urls[keyOf(link)] {
+		return
+	}
+
+	if link.ID != "" {
+		if _, ok := index.ids[normalizeLabel(link.ID)]; ok {
+			return
 		}
-		if info.IsDir() {
-			return nil
+	}
+	if link.ID == "" {
+		link.ID = index.newID(link, c.options.IDs)
+	}
+
+	c.Links = append(c.Links, link)
+	index.add(link, len(c.Links)-1)
+}
+
+func (c *MarkdownConverter) extractLinksFromReferences(doc *document) {
+	referenced := make(map[string]bool)
+	for _, l := range doc.links {
+		if l.isReference() {
+			referenced[normalizeLabel(l.label)] = true
 		}
-		if filepath.Ext(path) != ".md" {
-			return nil
+	}
+	// Unused definitions are dropped for the ones in use with the same URL,
+	// wherever these are
+	used := make(map[linkKey]bool)
+	for _, d := range doc.definitions {
+		if referenced[normalizeLabel(d.label)] && !d.isFootnote() {
+			used[linkKey{url: d.destination, title: d.title}] = true
 		}
-		content, err := os.ReadFile(path)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", path, err)
-			return err
+	}
+	for _, d := range doc.definitions {
+		link := Link{URL: d.destination, ID: d.label, Title: d.title}
+		switch {
+		case d.isFootnote():
+			c.addLink("", d.destination, d.label)
+		case referenced[normalizeLabel(d.label)]:
+			// A definition in use keeps its place, even if another one has
+			// the same URL
+			c.addDefined(link)
+		case !used[keyOf(link)]:
+			c.add(link)
 		}
-		mc := MarkdownConverter{originalContent: content}
-		mc.Run()
-		newContent := mc.modifiedContent
+	}
+}
 
-		if bytes.Equal(content, newContent) {
-			log.Printf("%s: Nothing to update\n", path)
-			return nil
-		}
-		if backup {
-			backupFile(path)
+// addDefined adds the link unless there already is one with the same ID
+func (c *MarkdownConverter) addDefined(link Link) {
+	index := c.buildIndex()
+	if _, ok := index.ids[normalizeLabel(link.ID)]; ok {
+		return
+	}
+	c.Links = append(c.Links, link)
+	index.add(link, len(c.Links)-1)
+}
+
+// markImageDefinitions marks the links defined for images only, so that their
+// definitions are grouped apart or, with the inline policy, removed
+func (c *MarkdownConverter) markImageDefinitions(doc *document) {
+	if c.options.Images == ImagesSkip {
+		return
+	}
+	images := imageOnlyLabels(doc)
+	for i := range c.Links {
+		if images[normalizeLabel(c.Links[i].ID)] {
+			c.Links[i].Image = true
 		}
-		err = os.WriteFile(path, newContent, 0644)
+	}
+	// The keys of the marked links changed
+	c.index = nil
+}
 
-		if err != nil {
-			fmt.Printf("Error updating file %s: %v\n", path, err)
-			return err
+// imageOnlyLabels returns the normalized labels referenced by images only
+func imageOnlyLabels(doc *document) map[string]bool {
+	labels := make(map[string]bool)
+	for _, l := range doc.links {
+		if !l.isReference() {
+			continue
 		}
-		log.Printf("%s updated successfully!\n", path)
+		label := normalizeLabel(l.label)
+		if used, ok := labels[label]; ok {
+			labels[label] = used && l.image
+		} else {
+			labels[label] = l.image
+		}
+	}
+	return labels
+}
 
-		return nil
-	})
-	fmt.Printf("Completed!\n")
+func (c *MarkdownConverter) Run() {
+	doc := parseDocument(c.originalContent)
+	// Text like [1] would turn into a link if a new reference used its label
+	c.bracketed = doc.bracketed
+	c.extractLinksFromReferences(doc)
+	c.markImageDefinitions(doc)
+	c.extractMarkdownLinksFromDocument(doc)
+	if c.options.Renumber {
+		c.renumbered = c.renumber(doc)
+	}
+	if c.options.Footnotes == FootnotesReference {
+		c.footnotes = c.convertFootnotes(doc)
+	}
+	edits := c.cleanupEdits(doc)
+	placed, links := c.placeDefinitions(doc, c.definedLinks())
+	if len(links) > 0 && doc.unclosed >= 0 {
+		// At the end, the definitions would be part of the block left open
+		placed = append(placed, c.beforeUnclosedBlock(doc, links))
+		links = nil
+	}
+	if len(links) > 0 {
+		placed = append(placed, c.atEndOfFile(links))
+	}
+	c.edits = tidyEdits(c.originalContent, append(edits, placed...))
+	c.modifiedContent = applyEdits(c.originalContent, c.edits)
 }
 
-func backupFile(filename string) error {
-	backupFilename := filename + ".bak"
-	_, err := os.Stat(backupFilename)
-	if err == nil {
-		return fmt.Errorf("backup file already exists: %s", backupFilename)
+// atEndOfFile returns the edit adding the definitions at the end of the
+// document, after a blank line
+func (c *MarkdownConverter) atEndOfFile(links []Link) edit {
+	end := len(c.originalContent)
+	block := "\n" + c.endOfFileDefinitions(links) + "\n"
+	if end > 0 && c.originalContent[end-1] != '\n' {
+		block = "\n" + block
 	}
-	if !os.IsNotExist(err) {
-		return err
+	return edit{span: span{end, end}, replacement: block}
+}
+
+// beforeUnclosedBlock returns the edit putting the definitions before the
+// block running until the end of the document, in place of the definitions
+// already there
+func (c *MarkdownConverter) beforeUnclosedBlock(doc *document, links []Link) edit {
+	pos := doc.unclosed
+	for i := len(doc.definitions) - 1; i >= 0; i-- {
+		if d := doc.definitions[i]; d.end <= pos && isBlank(doc.source[d.end:pos]) {
+			pos = d.start
+		}
 	}
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return err
+	block := c.endOfFileDefinitions(links) + "\n\n"
+	if pos > 0 {
+		block = "\n" + block
 	}
-	err = os.WriteFile(backupFilename, data, 0644)
-	if err != nil {
-		return err
+	return edit{span: span{pos, pos}, replacement: block}
+}
+
+// definedLinks returns the links that have a URL to put in a definition.
+// References to labels that are defined nowhere are left as they are, so
+// that running the converter again doesn't produce empty definitions.
+func (c *MarkdownConverter) definedLinks() []Link {
+	var links []Link
+	for _, link := range c.Links {
+		if link.URL != "" && !(link.Image && c.options.Images == ImagesInline) {
+			links = append(links, link)
+		}
 	}
-	fmt.Printf("Backup created: %s\n", backupFilename)
-	return nil
+	return links
 }
@@ -2,10 +2,16 @@ package converter
 
 import (
 	"bytes"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata")
+
 func TestAddLink(t *testing.T) {
 	converter := MarkdownConverter{}
 	converter.addLink("Google", "https://www.google.com", "ref")
@@ -34,15 +40,15 @@ func TestExtractMarkdownLinksFromBuffer(t *testing.T) {
 	})
 	t.Run("works with inline links", func(t *testing.T) {
 		content := []byte(`
-		[Google](https://www.google.com) fdafd
-		[GitHub][1]
-		[Wikipedia][ref] fdsf ds
-		[Example page][Example]
-		[Invalid Link]
-		[1]: https://github.com
-		[ref]: https://www.wikipedia.org
-		[Example]: https://example.com
-	`)
+[Google](https://www.google.com) fdafd
+[GitHub][1]
+[Wikipedia][ref] fdsf ds
+[Example page][Example]
+[Invalid Link]
+[1]: https://github.com
+[ref]: https://www.wikipedia.org
+[Example]: https://example.com
+`)
 
 		expectedLinks := []Link{
 			{Name: "GitHub", URL: "https://github.com", ID: "1"},
@@ -59,12 +65,12 @@ func TestExtractMarkdownLinksFromBuffer(t *testing.T) {
 	})
 	t.Run("works with footnotes too", func(t *testing.T) {
 		mixedContent := []byte(`
-		[Google](https://www.google.com)
-		[GitHub][1]
-		footnote example[^1]
-		[1]: https://github.com
-		[^1]: some footnote
-	`)
+[Google](https://www.google.com)
+[GitHub][1]
+footnote example[^1]
+[1]: https://github.com
+[^1]: some footnote
+`)
 		expectedLinks := []Link{
 			{Name: "GitHub", URL: "https://github.com", ID: "1"},
 			{Name: "Google", URL: "https://www.google.com", ID: "2"},
@@ -179,6 +185,358 @@ second line
 `)
 		compareConvertResults(t, content, expectedOutput)
 	})
+
+	t.Run("doesn't touch code samples", func(t *testing.T) {
+		content := []byte("Check [Google](https://www.google.com) or run `curl [x](https://www.google.com)`\n\n```bash\necho \"[Google](https://www.google.com)\"\n[1]: https://github.com\n```\n")
+
+		expectedOutput := []byte("Check [Google][1] or run `curl [x](https://www.google.com)`\n\n```bash\necho \"[Google](https://www.google.com)\"\n[1]: https://github.com\n```\n\n[1]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("doesn't touch code in list items", func(t *testing.T) {
+		content := []byte("- Example config:\n\n      [core]\n      [1]: https://internal.example/not-a-def\n\n  See [Google](https://www.google.com)\n")
+
+		expectedOutput := []byte("- Example config:\n\n      [core]\n      [1]: https://internal.example/not-a-def\n\n  See [Google][1]\n\n[1]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the tabs indenting list items after removed definitions", func(t *testing.T) {
+		content := []byte("*\n [1]: https://www.google.com\n\t\tSee [Google][1]\n")
+
+		expectedOutput := []byte("*\n\tSee [Google][1]\n\n[1]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("puts the definitions before a code block left open", func(t *testing.T) {
+		content := []byte("Check [Google](https://www.google.com)\n\n```bash\necho [Google](https://www.google.com)\n")
+
+		expectedOutput := []byte("Check [Google][1]\n\n[1]: https://www.google.com\n\n```bash\necho [Google](https://www.google.com)\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the line endings of the document", func(t *testing.T) {
+		content := []byte("Check [Google](https://www.google.com)\r\n\r\n[1]: https://github.com\r\n\r\nSee [GitHub][1]\r\n")
+
+		expectedOutput := []byte("Check [Google][2]\r\n\r\nSee [GitHub][1]\r\n\r\n[1]: https://github.com\r\n[2]: https://www.google.com\r\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the byte order mark", func(t *testing.T) {
+		content := []byte("\xef\xbb\xbf[1]: https://github.com\n\nSee [GitHub][1] and [Google](https://www.google.com)\n")
+
+		expectedOutput := []byte("\xef\xbb\xbf\nSee [GitHub][1] and [Google][2]\n\n[1]: https://github.com\n[2]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the empty lines away from the changes", func(t *testing.T) {
+		content := []byte("Check [Google](https://www.google.com)\n\n\n\nSome text  \n\n```\n\n\n\n```\n\n[1]: https://github.com\n\n\n")
+
+		expectedOutput := []byte("Check [Google][2]\n\n\n\nSome text  \n\n```\n\n\n\n```\n\n[1]: https://github.com\n[2]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the code after a list out of it", func(t *testing.T) {
+		content := []byte("- [Google](https://www.google.com)\n\n[1]: https://github.com\n\n    code\n")
+
+		expectedOutput := []byte("- [Google][2]\n\n<!-- -->\n\n    code\n\n[1]: https://github.com\n[2]: https://www.google.com\n")
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("leaves documents without links as they are", func(t *testing.T) {
+		content := []byte("first line\r\n\r\n\r\nlast line  ")
+
+		compareConvertResults(t, content, content)
+	})
+
+	t.Run("leaves links whose rewriting would change the text around them", func(t *testing.T) {
+		content := []byte("[a](<b c> \"two\nlines\") [d]([e](f g)) [h](i]) <https://go.dev>\n")
+
+		compareConvertResults(t, content, content)
+	})
+
+	t.Run("handles URLs with parentheses", func(t *testing.T) {
+		content := []byte(`[Go](https://en.wikipedia.org/wiki/Go_(programming_language)) is (https://go.dev) nice
+`)
+
+		expectedOutput := []byte(`[Go][1] is (https://go.dev) nice
+
+[1]: https://en.wikipedia.org/wiki/Go_(programming_language)
+`)
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps link titles", func(t *testing.T) {
+		content := []byte(`[a](https://example.com "Double") [b](https://example.com 'Single') [c](https://example.com (Parens))
+[d](https://example.com "Double") [e](https://example.com) [f](<https://example.com/a b> "Say \"hi\"")
+`)
+
+		expectedOutput := []byte(`[a][1] [b][2] [c][3]
+[d][1] [e][4] [f][5]
+
+[1]: https://example.com "Double"
+[2]: https://example.com "Single"
+[3]: https://example.com "Parens"
+[4]: https://example.com
+[5]: <https://example.com/a b> "Say \"hi\""
+`)
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the titles of definitions spanning lines", func(t *testing.T) {
+		content := []byte(`[a][a] and [b](https://b.com)
+
+[a]:
+  https://a.com
+  "The title"
+`)
+
+		expectedOutput := []byte(`[a][a] and [b][1]
+
+[1]: https://b.com
+
+[a]: https://a.com "The title"
+`)
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("moves definitions out of blockquotes", func(t *testing.T) {
+		content := []byte(`> Quote with [q](https://q.com).
+>
+> [a]: https://a.com
+>
+> More [b][a].
+`)
+
+		expectedOutput := []byte(`> Quote with [q][1].
+>
+>
+> More [b][a].
+
+[1]: https://q.com
+
+[a]: https://a.com
+`)
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps apart the lines around removed definitions", func(t *testing.T) {
+		content := []byte(`[Label]:
+[a]: https://a.com
+https://b.com
+`)
+
+		expectedOutput := []byte(`[Label]:
+
+https://b.com
+
+[a]: https://a.com
+`)
+		compareConvertResults(t, content, expectedOutput)
+	})
+
+	t.Run("extracts titles", func(t *testing.T) {
+		content := []byte(`[Google](https://www.google.com 'Search') [GitHub][gh]
+
+[gh]: https://github.com (Code)
+`)
+
+		converter := MarkdownConverter{}
+		converter.extractMarkdownLinksFromBuffer(content)
+
+		assertLinksEqual(t, converter.Links, []Link{
+			{Name: "GitHub", URL: "https://github.com", ID: "gh", Title: "Code"},
+			{Name: "Google", URL: "https://www.google.com", ID: "1", Title: "Search"},
+		})
+	})
+}
+
+func TestImagePolicies(t *testing.T) {
+	content := []byte(`See ![logo](logo.png) and [site](https://example.com)
+
+[![badge](https://ci.example.com/badge.svg)](https://ci.example.com)
+![photo][pic] and [photo][shared] and ![again][shared]
+
+[pic]: pic.png
+[shared]: shared.png
+`)
+
+	tests := []struct {
+		policy   ImagePolicy
+		expected string
+	}{
+		{ImagesReference, `See ![logo][1] and [site][2]
+
+[![badge][4]][3]
+![photo][pic] and [photo][shared] and ![again][shared]
+
+[2]: https://example.com
+[3]: https://ci.example.com
+
+[shared]: shared.png
+
+[1]: logo.png
+[4]: https://ci.example.com/badge.svg
+[pic]: pic.png
+`},
+		{ImagesInline, `See ![logo](logo.png) and [site][1]
+
+[![badge](https://ci.example.com/badge.svg)][2]
+![photo](pic.png) and [photo][shared] and ![again][shared]
+
+[1]: https://example.com
+[2]: https://ci.example.com
+
+[shared]: shared.png
+`},
+		{ImagesSkip, `See ![logo](logo.png) and [site][1]
+
+[![badge](https://ci.example.com/badge.svg)][2]
+![photo][pic] and [photo][shared] and ![again][shared]
+
+[1]: https://example.com
+[2]: https://ci.example.com
+
+[pic]: pic.png
+[shared]: shared.png
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			compareConvertResultsWithOptions(t, Options{Images: test.policy}, content, []byte(test.expected))
+		})
+	}
+}
+
+func TestAutolinkPolicies(t *testing.T) {
+	content := []byte(`See <https://example.com/docs> and https://github.com/lubieniebieski.
+Or www.example.com, [GitHub](https://github.com/lubieniebieski) and ` + "`https://example.com/code`" + `
+`)
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{"keep", Options{}, `See <https://example.com/docs> and https://github.com/lubieniebieski.
+Or www.example.com, [GitHub][1] and ` + "`https://example.com/code`" + `
+
+[1]: https://github.com/lubieniebieski
+`},
+		{"reference", Options{Autolinks: AutolinksReference}, `See [example.com][2] and [github.com][1].
+Or [www.example.com][3], [GitHub][1] and ` + "`https://example.com/code`" + `
+
+[1]: https://github.com/lubieniebieski
+[2]: https://example.com/docs
+[3]: http://www.example.com
+`},
+		{"reference with titles", Options{Autolinks: AutolinksReference, AutolinkText: func(url string) string { return "Page [" + url + "]" }},
+			`See [Page \[https://example.com/docs\]][2] and [Page \[https://github.com/lubieniebieski\]][1].
+Or [Page \[http://www.example.com\]][3], [GitHub][1] and ` + "`https://example.com/code`" + `
+
+[1]: https://github.com/lubieniebieski
+[2]: https://example.com/docs
+[3]: http://www.example.com
+`},
+		{"normalize", Options{Autolinks: AutolinksNormalize}, `See <https://example.com/docs> and <https://github.com/lubieniebieski>.
+Or <http://www.example.com>, [GitHub][1] and ` + "`https://example.com/code`" + `
+
+[1]: https://github.com/lubieniebieski
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compareConvertResultsWithOptions(t, test.options, content, []byte(test.expected))
+		})
+	}
+}
+
+func TestIDStrategies(t *testing.T) {
+	content := []byte(`[Google](https://www.google.com) and [GitHub](https://github.com/lubieniebieski)
+[Google again](https://www.google.com) and [GitHub](https://github.com) [Go][go]
+
+[go]: https://go.dev
+`)
+
+	tests := []struct {
+		strategy IDStrategy
+		expected string
+	}{
+		{IDsNumeric, `[Google][1] and [GitHub][2]
+[Google again][1] and [GitHub][3] [Go][go]
+
+[1]: https://www.google.com
+[2]: https://github.com/lubieniebieski
+[3]: https://github.com
+
+[go]: https://go.dev
+`},
+		{IDsSlug, `[Google][google] and [GitHub][github]
+[Google again][google] and [GitHub][github-2] [Go][go]
+
+[github]: https://github.com/lubieniebieski
+[github-2]: https://github.com
+[go]: https://go.dev
+[google]: https://www.google.com
+`},
+		{IDsDomain, `[Google][google-com-1] and [GitHub][github-com-1]
+[Google again][google-com-1] and [GitHub][github-com-2] [Go][go]
+
+[github-com-1]: https://github.com/lubieniebieski
+[github-com-2]: https://github.com
+[go]: https://go.dev
+[google-com-1]: https://www.google.com
+`},
+		{IDsHash, `[Google][ac6bb66] and [GitHub][link-5221110]
+[Google again][ac6bb66] and [GitHub][996e1f7] [Go][go]
+
+[go]: https://go.dev
+[ac6bb66]: https://www.google.com
+[link-5221110]: https://github.com/lubieniebieski
+[996e1f7]: https://github.com
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.strategy), func(t *testing.T) {
+			compareConvertResultsWithOptions(t, Options{IDs: test.strategy}, content, []byte(test.expected))
+		})
+	}
+}
+
+func TestGoldenFiles(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "links_as_references", "*.input.md"))
+	if err != nil {
+		t.Fatalf("Failed to list golden files: %v", err)
+	}
+
+	for _, input := range inputs {
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), ".input.md")
+		golden := strings.TrimSuffix(input, ".input.md") + ".golden.md"
+
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("Failed to read input file: %v", err)
+			}
+			output := convert(content)
+
+			if *update {
+				if err := os.WriteFile(golden, output, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			expectedOutput, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+
+			compareResults(output, expectedOutput, t)
+			compareResults(convert(output), output, t)
+		})
+	}
 }
 
 func TestRun(t *testing.T) {
@@ -211,7 +569,13 @@ func TestRun(t *testing.T) {
 	}
 	defer os.Remove(filename)
 
-	ConvertFilesInPath(filename, false, false)
+	summary, err := ConvertFilesInPath(filename, FileOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if summary != (Summary{Processed: 1, Changed: 1}) {
+		t.Errorf("Expected one processed and changed file, but got %+v", summary)
+	}
 
 	newContent, err := os.ReadFile(filename)
 	if err != nil {
@@ -223,6 +587,30 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func BenchmarkRun(b *testing.B) {
+	content := benchmarkDocument(200)
+	b.SetBytes(int64(len(content)))
+
+	for i := 0; i < b.N; i++ {
+		converter := MarkdownConverter{originalContent: content}
+		converter.Run()
+	}
+}
+
+// benchmarkDocument returns a document with the given number of sections,
+// each with a few inline and reference links, a code block and a footnote
+func benchmarkDocument(sections int) []byte {
+	var doc bytes.Buffer
+	for i := 0; i < sections; i++ {
+		fmt.Fprintf(&doc, "## Section %d\n\n", i)
+		fmt.Fprintf(&doc, "Some text with [a link](https://example.com/%d) and [another one](https://example.com/%d/other \"Title\"),\n", i, i)
+		fmt.Fprintf(&doc, "a [reference][ref%d], some `inline code` and a footnote[^%d].\n\n", i, i)
+		fmt.Fprintf(&doc, "```go\nfmt.Println(\"[not a link](https://example.com)\")\n```\n\n")
+		fmt.Fprintf(&doc, "[ref%d]: https://example.com/ref/%d\n[^%d]: Footnote %d.\n\n", i, i, i, i)
+	}
+	return doc.Bytes()
+}
+
 func assertLinksEqual(t *testing.T, links []Link, expectedLinks []Link) {
 	t.Helper()
 	if len(links) != len(expectedLinks) {
@@ -237,6 +625,10 @@ func assertLinksEqual(t *testing.T, links []Link, expectedLinks []Link) {
 			t.Errorf("Expected link URL '%s', but got '%s'", expectedLinks[i].URL, link.URL)
 		}
 
+		if link.Title != expectedLinks[i].Title {
+			t.Errorf("Expected link title '%s', but got '%s'", expectedLinks[i].Title, link.Title)
+		}
+
 		if link.ID != expectedLinks[i].ID {
 			t.Errorf("Expected link ID '%s', but got '%s'", expectedLinks[i].ID, link.ID)
 		}
@@ -245,10 +637,115 @@ func assertLinksEqual(t *testing.T, links []Link, expectedLinks []Link) {
 
 func compareConvertResults(t *testing.T, input []byte, expectations []byte) {
 	t.Helper()
-	converter := MarkdownConverter{originalContent: input}
+	output := convert(input)
+
+	if !bytes.Equal(output, expectations) {
+		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectations, output)
+	}
+	if again := convert(output); !bytes.Equal(again, output) {
+		t.Errorf("Expected running the converter again to change nothing, but got:\n%s", again)
+	}
+}
+
+// compareConvertResultsWithOptions converts the input with the options,
+// compares the output to the expectations and checks that converting it
+// again changes nothing
+func compareConvertResultsWithOptions(t *testing.T, options Options, input []byte, expectations []byte) {
+	t.Helper()
+	c := NewConverter(options)
+	output, _, err := c.convert(input)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if !bytes.Equal(output, expectations) {
+		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectations, output)
+	}
+	if again, _, _ := c.convert(output); !bytes.Equal(again, output) {
+		t.Errorf("Expected running the converter again to change nothing, but got:\n%s", again)
+	}
+}
+
+func convert(content []byte) []byte {
+	converter := MarkdownConverter{originalContent: content}
 	converter.Run()
+	return converter.modifiedContent
+}
+
+// FuzzRun checks that converting any document, with any options, doesn't
+// panic, keeps its links and can be done again without changing anything
+func FuzzRun(f *testing.F) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "links_as_references", "*.input.md"))
+	if err != nil {
+		f.Fatalf("Failed to list golden files: %v", err)
+	}
+	for _, input := range inputs {
+		content, err := os.ReadFile(input)
+		if err != nil {
+			f.Fatalf("Failed to read input file: %v", err)
+		}
+		f.Add(content, uint16(0))
+	}
+
+	f.Fuzz(func(t *testing.T, content []byte, choice uint16) {
+		options := fuzzOptions(choice)
+		convert := func(content []byte) []byte {
+			c := MarkdownConverter{originalContent: content, options: options}
+			c.Run()
+			return c.modifiedContent
+		}
+		c := MarkdownConverter{originalContent: content, options: options}
+		c.Run()
+		output := c.modifiedContent
+
+		// The edits are sorted, don't overlap and all change something
+		for i, e := range c.edits {
+			if e.start > e.end || (i > 0 && e.start < c.edits[i-1].end) || e.replacement == string(content[e.start:e.end]) {
+				t.Errorf("Expected precise edits of\n%q\nwith %+v, but got %+v", content, options, c.edits)
+				break
+			}
+		}
 
-	if !bytes.Equal(converter.modifiedContent, expectations) {
-		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectations, converter.modifiedContent)
+		// Autolinks may become links, but no link appears or disappears, the
+		// ones of inline footnotes going to the text of their definitions.
+		// Only the first definition of a footnote counts, as the others are
+		// ignored.
+		var count func(content []byte) int
+		count = func(content []byte) int {
+			doc := parseDocument(content)
+			n := len(doc.links) + len(doc.autolinks)
+			defined := make(map[string]bool)
+			for _, d := range doc.definitions {
+				if label := normalizeLabel(d.label); d.isFootnote() && !defined[label] {
+					defined[label] = true
+					n += count([]byte(d.destination))
+				}
+			}
+			return n
+		}
+		if before, after := count(content), count(output); before != after {
+			t.Errorf("Expected the %d links of\n%q\nto be kept with %+v, but got %d in\n%q", before, content, options, after, output)
+		}
+		if again := convert(output); !bytes.Equal(again, output) {
+			t.Errorf("Expected running the converter again on\n%q\nwith %+v to change nothing, but got\n%q", output, options, again)
+		}
+	})
+}
+
+// fuzzOptions picks the options of the conversion from the bits of choice
+func fuzzOptions(choice uint16) Options {
+	pick := func(bits int) int {
+		n := int(choice) % (1 << bits)
+		choice >>= bits
+		return n
+	}
+	return Options{
+		IDs:          []IDStrategy{IDsNumeric, IDsSlug, IDsDomain, IDsHash}[pick(2)],
+		Images:       []ImagePolicy{ImagesReference, ImagesInline, ImagesSkip, ImagesReference}[pick(2)],
+		Autolinks:    []AutolinkPolicy{AutolinksKeep, AutolinksReference, AutolinksNormalize, AutolinksKeep}[pick(2)],
+		Footnotes:    []FootnotePolicy{FootnotesKeep, FootnotesReference}[pick(1)],
+		Renumber:     pick(1) == 1,
+		Placement:    []Placement{PlacementEnd, PlacementSection, PlacementMarkers, PlacementEnd}[pick(2)],
+		SectionLevel: pick(2),
 	}
 }
@@ -0,0 +1,251 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const diffContext = 3
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the changes between the original and the modified
+// content of a file in the unified format, or an empty string if there are none
+func unifiedDiff(name string, original, modified []byte, color bool) string {
+	ops := diffLines(splitLines(original), splitLines(modified))
+
+	var output strings.Builder
+	// paint writes a single line, colored if asked to
+	paint := func(c, line string) {
+		if color && c != "" {
+			line = c + line + colorReset
+		}
+		output.WriteString(line + "\n")
+	}
+
+	// Line numbers in the original and the modified content before each op
+	aLines := make([]int, len(ops)+1)
+	bLines := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.kind != '+' {
+			aLines[i+1]++
+		}
+		if op.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		if output.Len() == 0 {
+			paint(colorBold, "--- "+name)
+			paint(colorBold, "+++ "+name)
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// Changes closer to each other than twice the context share a hunk
+		end := i + 1
+		for j := i; j < len(ops) && j-end < 2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		paint(colorCyan, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(aLines[start], aLines[end]-aLines[start]),
+			hunkRange(bLines[start], bLines[end]-bLines[start])))
+		for _, op := range ops[start:end] {
+			c := ""
+			switch op.kind {
+			case '-':
+				c = colorRed
+			case '+':
+				c = colorGreen
+			}
+			paint(c, string(op.kind)+strings.TrimSuffix(op.line, "\n"))
+			if !strings.HasSuffix(op.line, "\n") {
+				output.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return output.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits the content into lines, keeping the line endings
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines finds the shortest edit script between two lists of lines using
+// the linear space variant of the Myers algorithm. Within each run of changes,
+// the removed lines come before the added ones.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	compareLines(a, b, &ops)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(x, y int) bool {
+			return ops[i+x].kind == '-' && ops[i+y].kind == '+'
+		})
+		i = j
+	}
+	return ops
+}
+
+// compareLines appends the edit script turning a into b to the ops, splitting
+// the lines at the middle of the shortest script until only additions or
+// removals are left
+func compareLines(a, b []string, ops *[]diffOp) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		*ops = append(*ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			*ops = append(*ops, diffOp{'+', line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			*ops = append(*ops, diffOp{'-', line})
+		}
+	default:
+		x, y := middleSnake(a, b)
+		compareLines(a[:x], b[:y], ops)
+		compareLines(a[x:], b[y:], ops)
+	}
+	for _, line := range common {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+}
+
+// middleSnake returns a point on a shortest path from the start to the end
+// of the edit graph, found by following the paths from both ends until they
+// overlap. The lines must differ at both ends, so that the point is neither.
+func middleSnake(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// forward and backward hold the furthest x reached on each diagonal,
+	// counted from the start and from the end of the lines
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// The diagonals running off the graph are skipped from then on
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				if c := offset + delta - k; c >= 0 && c < len(backward) && backward[c] >= 0 && backward[c] <= n && x >= n-backward[c] {
+					return x, y
+				}
+			}
+		}
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !odd:
+				if c := offset + delta - k; c >= 0 && c < len(forward) && forward[c] >= 0 && forward[c] <= n && forward[c] >= n-x {
+					return forward[c], forward[c] - (c - offset)
+				}
+			}
+		}
+	}
+	// The paths always meet, this is only a safe way out
+	return n, 0
+}
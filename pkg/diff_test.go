@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("returns empty string for equal content", func(t *testing.T) {
+		content := []byte("first line\nsecond line\n")
+
+		if output := unifiedDiff("test.md", content, content, false); output != "" {
+			t.Errorf("Expected no diff, but got:\n%s", output)
+		}
+	})
+
+	t.Run("shows changed lines with context", func(t *testing.T) {
+		original := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+		modified := []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n")
+		expectedOutput := `--- test.md
++++ test.md
+@@ -2,9 +2,10 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
++11
+`
+
+		if output := unifiedDiff("test.md", original, modified, false); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("splits distant changes into hunks", func(t *testing.T) {
+		original := []byte("a\n1\n2\n3\n4\n5\n6\n7\nb\n")
+		modified := []byte("A\n1\n2\n3\n4\n5\n6\n7\nB\n")
+		expectedOutput := `--- test.md
++++ test.md
+@@ -1,4 +1,4 @@
+-a
++A
+ 1
+ 2
+ 3
+@@ -6,4 +6,4 @@
+ 5
+ 6
+ 7
+-b
++B
+`
+
+		if output := unifiedDiff("test.md", original, modified, false); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("marks missing newline at end of file", func(t *testing.T) {
+		original := []byte("first line")
+		modified := []byte("first line\n")
+		expectedOutput := `--- test.md
++++ test.md
+@@ -1 +1 @@
+-first line
+\ No newline at end of file
++first line
+`
+
+		if output := unifiedDiff("test.md", original, modified, false); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("replaces files changed as a whole in a single hunk", func(t *testing.T) {
+		var original, modified, removed, added strings.Builder
+		for i := 1; i <= 4000; i++ {
+			fmt.Fprintf(&original, "old %d\n", i)
+			fmt.Fprintf(&modified, "new %d\n", i)
+			fmt.Fprintf(&removed, "-old %d\n", i)
+			fmt.Fprintf(&added, "+new %d\n", i)
+		}
+		expectedOutput := "--- test.md\n+++ test.md\n@@ -1,4000 +1,4000 @@\n" + removed.String() + added.String()
+
+		if output := unifiedDiff("test.md", []byte(original.String()), []byte(modified.String()), false); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("colors the output", func(t *testing.T) {
+		expectedOutput := colorBold + "--- test.md" + colorReset + "\n" +
+			colorBold + "+++ test.md" + colorReset + "\n" +
+			colorCyan + "@@ -1 +1 @@" + colorReset + "\n" +
+			colorRed + "-a" + colorReset + "\n" +
+			colorGreen + "+b" + colorReset + "\n"
+
+		if output := unifiedDiff("test.md", []byte("a\n"), []byte("b\n"), true); output != expectedOutput {
+			t.Errorf("Expected output:\n%q\n\nBut got:\n%q", expectedOutput, output)
+		}
+	})
+}
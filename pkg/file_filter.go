@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultExtensions are the extensions of the files processed when
+// FileOptions.Extensions is empty
+var DefaultExtensions = []string{".md"}
+
+// DefaultExclude lists the directories that hardly ever hold documents
+// worth converting, skipped along with FileOptions.Exclude unless
+// FileOptions.NoDefaultExclude is set
+var DefaultExclude = []string{".git", "node_modules", "vendor"}
+
+// fileFilter decides which files and directories under an input root
+// are processed
+type fileFilter struct {
+	root       string
+	extensions []string
+	include    []string
+	exclude    []string
+	gitignore  *gitignore
+	// configs finds the configuration files, nil if they are not used
+	configs *configFinder
+}
+
+func newFileFilter(root string, options FileOptions, configs *configFinder) (*fileFilter, error) {
+	f := &fileFilter{root: root, include: options.Include, exclude: options.Exclude, configs: configs}
+	if !options.NoDefaultExclude {
+		f.exclude = append(f.exclude[:len(f.exclude):len(f.exclude)], DefaultExclude...)
+	}
+
+	extensions := options.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	for _, extension := range extensions {
+		f.extensions = append(f.extensions, "."+strings.TrimPrefix(strings.ToLower(extension), "."))
+	}
+
+	if options.Gitignore {
+		g, err := newGitignore(root)
+		if err != nil {
+			return nil, err
+		}
+		f.gitignore = g
+	}
+	return f, nil
+}
+
+// enterDir loads the .gitignore file of a directory before its content is visited
+func (f *fileFilter) enterDir(dir string) error {
+	if f.gitignore == nil || sameDir(dir, f.root) {
+		return nil
+	}
+	return f.gitignore.load(dir)
+}
+
+func (f *fileFilter) skipDir(dir string) bool {
+	if matchesAny(f.exclude, f.relative(dir)) || !f.configAccepts(dir, true) {
+		return true
+	}
+	return f.gitignore != nil && f.gitignore.ignored(dir, true)
+}
+
+func (f *fileFilter) accepts(name string) bool {
+	if !f.hasExtension(name) {
+		return false
+	}
+	relativePath := f.relative(name)
+	if len(f.include) > 0 && !matchesAny(f.include, relativePath) {
+		return false
+	}
+	if matchesAny(f.exclude, relativePath) || !f.configAccepts(name, false) {
+		return false
+	}
+	return f.gitignore == nil || !f.gitignore.ignored(name, false)
+}
+
+// configAccepts tells if the patterns of the configuration files let the
+// file or directory be processed. Broken configuration files are reported
+// when the options of the files are read.
+func (f *fileFilter) configAccepts(name string, isDir bool) bool {
+	if f.configs == nil {
+		return true
+	}
+	config, err := f.configs.find(filepath.Dir(name))
+	return err != nil || config.accepts(name, isDir)
+}
+
+// options returns the options of the file, with the settings of the
+// configuration files if they are used
+func (f *fileFilter) options(name string, options FileOptions) (FileOptions, error) {
+	if f.configs == nil {
+		return options, nil
+	}
+	config, err := f.configs.find(filepath.Dir(name))
+	if err != nil {
+		return options, err
+	}
+	return config.Merge(*options.Config).Apply(options), nil
+}
+
+func (f *fileFilter) hasExtension(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, e := range f.extensions {
+		if extension == e {
+			return true
+		}
+	}
+	return false
+}
+
+// relative returns the slash-separated path relative to the input root
+func (f *fileFilter) relative(name string) string {
+	relativePath, err := filepath.Rel(f.root, name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	return filepath.ToSlash(relativePath)
+}
+
+// matchesAny tells if the path matches one of the patterns. Patterns
+// without a slash match the name of the file or directory at any depth,
+// others match the whole path relative to the input root.
+func matchesAny(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if matchGlob(strings.TrimPrefix(pattern, "/"), relativePath) {
+				return true
+			}
+		} else if matchGlob(pattern, path.Base(relativePath)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a pattern in which,
+// besides the syntax of path.Match, ** matches any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"docs/*.md", "docs/README.md", true},
+		{"docs/**/*.md", "docs/README.md", true},
+		{"docs/**/*.md", "docs/a/b/README.md", true},
+		{"docs/**", "docs/a/b/README.md", true},
+		{"**/drafts", "a/b/drafts", true},
+		{"docs/**/*.md", "other/a/README.md", false},
+		{"[ab].md", "c.md", false},
+	}
+
+	for _, test := range tests {
+		if match := matchGlob(test.pattern, test.name); match != test.match {
+			t.Errorf("Expected %q matching %q to be %v, but got %v", test.pattern, test.name, test.match, match)
+		}
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	patterns := []string{"node_modules", "/docs/drafts/*.md"}
+
+	if !matchesAny(patterns, "a/b/node_modules") {
+		t.Errorf("Expected a pattern without a slash to match at any depth")
+	}
+	if !matchesAny(patterns, "docs/drafts/post.md") {
+		t.Errorf("Expected a pattern with a slash to match the relative path")
+	}
+	if matchesAny(patterns, "blog/docs/drafts/post.md") {
+		t.Errorf("Expected a pattern with a slash to be anchored to the root")
+	}
+}
+
+func TestConvertFilesInPathsFilters(t *testing.T) {
+	content := []byte("[Google](https://www.google.com)\n")
+
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		for _, name := range []string{
+			"README.md",
+			"notes.markdown",
+			"page.mdx",
+			"docs/guide.md",
+			"docs/drafts/draft.md",
+			"node_modules/package/README.md",
+			"other/index.md",
+		} {
+			writeTestFile(t, filepath.Join(dir, name), content)
+		}
+		return dir
+	}
+
+	tests := []struct {
+		name      string
+		paths     []string
+		options   FileOptions
+		processed int
+	}{
+		{"processes .md files by default", []string{"."}, FileOptions{}, 4},
+		{"processes the given extensions", []string{"."}, FileOptions{Extensions: []string{"md", ".markdown", ".MDX"}}, 6},
+		{"skips excluded files and directories", []string{"."}, FileOptions{Exclude: []string{"docs/drafts"}}, 3},
+		{"processes the default exclusions if asked", []string{"."}, FileOptions{NoDefaultExclude: true}, 5},
+		{"processes included files only", []string{"."}, FileOptions{Include: []string{"docs/**/*.md"}}, 2},
+		{"processes many paths", []string{"docs", "other", "README.md"}, FileOptions{}, 4},
+		{"processes files in overlapping paths once", []string{".", "docs"}, FileOptions{}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setup(t)
+			var paths []string
+			for _, path := range test.paths {
+				paths = append(paths, filepath.Join(dir, path))
+			}
+
+			test.options.Check = true
+			summary, err := ConvertFilesInPaths(paths, test.options)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if summary.Processed != test.processed {
+				t.Errorf("Expected %d processed files, but got %d", test.processed, summary.Processed)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"unicode/utf8"
+)
+
+func setupLogger(verbose bool) {
+	log.SetOutput(io.Discard)
+	if verbose {
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// FileOptions controls what happens to the converted files
+type FileOptions struct {
+	// Backup creates a .bak copy of every file before updating it
+	Backup bool
+	// Verbose logs what happens to every file
+	Verbose bool
+	// DryRun prints a unified diff of the changes instead of writing files
+	DryRun bool
+	// Color highlights the diff printed in the dry-run mode
+	Color bool
+	// Check lists the files that need changes, with the position of the
+	// first change, without writing anything
+	Check bool
+	// OutputDir, if set, is where converted files are written, mirroring
+	// the input tree, instead of updating them in place
+	OutputDir string
+	// Extensions of the files to process, DefaultExtensions if empty
+	Extensions []string
+	// Include, if not empty, limits the processed files to those matching
+	// one of the glob patterns
+	Include []string
+	// Exclude skips the files and directories matching one of the glob
+	// patterns, besides the ones of DefaultExclude
+	Exclude []string
+	// NoDefaultExclude processes the files and directories of DefaultExclude
+	NoDefaultExclude bool
+	// Gitignore skips the files and directories ignored by git
+	Gitignore bool
+	// Jobs is the number of files processed at the same time, the number
+	// of CPUs if not positive
+	Jobs int
+	// Conversion controls how links are converted. Its Inline field is
+	// set by the function converting the files.
+	Conversion Options
+	// Config, if not nil, makes every file use the settings of the
+	// configuration files found from its directory upwards, see FindConfig.
+	// The settings of Config itself take precedence over them.
+	Config *Config
+	// Output receives the reports of the files, the diffs and the lists of
+	// the check mode, in the order the files are found. It is the standard
+	// output if nil.
+	Output io.Writer
+}
+
+// Summary counts the files processed by ConvertFilesInPath and InlineFilesInPath
+type Summary struct {
+	// Processed is the number of Markdown files found
+	Processed int
+	// Changed is the number of files that were changed, or would be in the
+	// dry-run and check modes
+	Changed int
+	// Failed is the number of files that could not be read or written
+	Failed int
+}
+
+// ConvertFilesInPath converts inline links to references in all Markdown
+// files in the given path. Files that fail don't stop the others from being
+// processed, all errors are returned together.
+func ConvertFilesInPath(path string, options FileOptions) (Summary, error) {
+	return ConvertFilesInPaths([]string{path}, options)
+}
+
+// ConvertFilesInPaths does what ConvertFilesInPath does, for many paths
+func ConvertFilesInPaths(paths []string, options FileOptions) (Summary, error) {
+	options.Conversion.Inline = false
+	return processFilesInPaths(paths, options)
+}
+
+// InlineFilesInPath converts references back to inline links in all Markdown
+// files in the given path, the same way ConvertFilesInPath does the opposite
+func InlineFilesInPath(path string, options FileOptions) (Summary, error) {
+	return InlineFilesInPaths([]string{path}, options)
+}
+
+// InlineFilesInPaths does what InlineFilesInPath does, for many paths
+func InlineFilesInPaths(paths []string, options FileOptions) (Summary, error) {
+	options.Conversion.Inline = true
+	return processFilesInPaths(paths, options)
+}
+
+// ConvertStream converts inline links to references in the Markdown read
+// from r and writes the result to w
+func ConvertStream(r io.Reader, w io.Writer, options Options) error {
+	options.Inline = false
+	_, err := NewConverter(options).Convert(context.Background(), r, w)
+	return err
+}
+
+// InlineStream converts references back to inline links in the Markdown
+// read from r and writes the result to w
+func InlineStream(r io.Reader, w io.Writer, options Options) error {
+	options.Inline = true
+	_, err := NewConverter(options).Convert(context.Background(), r, w)
+	return err
+}
+
+// fileTask is a file to process, or an error met while looking for files.
+// Tasks are processed concurrently but reported in the order they were found.
+type fileTask struct {
+	path    string
+	target  string
+	options FileOptions
+	result  fileResult
+	done    chan struct{}
+}
+
+// fileResult is what processing a file led to. The report and the logs are
+// printed once all the files found before are reported.
+type fileResult struct {
+	changed bool
+	report  string
+	logs    []string
+	err     error
+}
+
+func processFilesInPaths(paths []string, options FileOptions) (Summary, error) {
+	setupLogger(options.Verbose)
+	output := options.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	workers := options.Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queue := make(chan *fileTask, 64*workers)
+	jobs := make(chan *fileTask)
+
+	go func() {
+		findFiles(paths, options, queue, jobs)
+		close(queue)
+		close(jobs)
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range jobs {
+				task.result = processFile(task.path, task.target, task.options)
+				close(task.done)
+			}
+		}()
+	}
+
+	var summary Summary
+	var errs []error
+	for task := range queue {
+		<-task.done
+		for _, message := range task.result.logs {
+			log.Print(message)
+		}
+		fmt.Fprint(output, task.result.report)
+
+		if task.path != "" {
+			summary.Processed++
+		}
+		if task.result.err != nil {
+			summary.Failed++
+			errs = append(errs, task.result.err)
+		} else if task.result.changed {
+			summary.Changed++
+		}
+	}
+	return summary, errors.Join(errs...)
+}
+
+// findFiles walks the paths and sends every file to process both to the
+// queue, in order, and to the workers. Errors only go to the queue.
+func findFiles(paths []string, options FileOptions, queue, jobs chan<- *fileTask) {
+	fail := func(err error) {
+		task := &fileTask{result: fileResult{err: err}, done: make(chan struct{})}
+		close(task.done)
+		queue <- task
+	}
+	// A file is processed once, even if it is in many of the paths
+	seen := make(map[string]bool)
+	var configs *configFinder
+	if options.Config != nil {
+		configs = newConfigFinder()
+	}
+
+	for _, path := range paths {
+		root, err := inputRoot(path)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if options.OutputDir != "" {
+			if err := checkOutputDir(root, options.OutputDir); err != nil {
+				fail(err)
+				continue
+			}
+		}
+		filter, err := newFileFilter(root, options, configs)
+		if err != nil {
+			fail(fmt.Errorf("reading ignored files for %s: %w", path, err))
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(name string, info os.DirEntry, err error) error {
+			if err != nil {
+				fail(fmt.Errorf("accessing %s: %w", name, err))
+				return nil
+			}
+			if info.IsDir() {
+				if name != path && filter.skipDir(name) {
+					return filepath.SkipDir
+				}
+				if err := filter.enterDir(name); err != nil {
+					fail(fmt.Errorf("reading ignored files in %s: %w", name, err))
+				}
+				return nil
+			}
+			if !filter.accepts(name) {
+				return nil
+			}
+			if absName, err := filepath.Abs(name); err == nil {
+				if seen[absName] {
+					return nil
+				}
+				seen[absName] = true
+			}
+
+			fileOptions, err := filter.options(name, options)
+			if err != nil {
+				fail(fmt.Errorf("configuring %s: %w", name, err))
+				return nil
+			}
+
+			task := &fileTask{path: name, target: name, options: fileOptions, done: make(chan struct{})}
+			if options.OutputDir != "" {
+				task.target = outputPath(root, name, options.OutputDir)
+			}
+			queue <- task
+			jobs <- task
+			return nil
+		})
+		if err != nil {
+			fail(err)
+		}
+	}
+}
+
+// processFile converts a single file, writing the result to the target path
+func processFile(path, target string, options FileOptions) (result fileResult) {
+	logf := func(format string, args ...interface{}) {
+		result.logs = append(result.logs, fmt.Sprintf(format, args...))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		result.err = fmt.Errorf("reading %s: %w", path, err)
+		return result
+	}
+	newContent, converted, err := NewConverter(options.Conversion).convert(content)
+	if err != nil {
+		result.err = fmt.Errorf("converting %s: %w", path, err)
+		return result
+	}
+	result.changed = converted.Changed
+
+	if converted.Skipped {
+		logf("%s: Skipped as its front matter asks\n", path)
+	} else if !result.changed {
+		logf("%s: Nothing to update\n", path)
+	}
+	if options.Check || options.DryRun {
+		if result.changed && options.Check {
+			line, column := position(content, firstDifference(content, newContent))
+			result.report = fmt.Sprintf("%s:%d:%d: needs to be converted\n", path, line, column)
+		} else if result.changed {
+			result.report = unifiedDiff(path, content, newContent, options.Color)
+			logf("%s would be updated\n", path)
+		}
+		return result
+	}
+	// Unchanged files are still copied, so that the output tree is complete
+	if !result.changed && target == path {
+		return result
+	}
+
+	if target == path && options.Backup {
+		backupFilename, err := backupFile(path)
+		if err != nil {
+			return fileResult{err: fmt.Errorf("backing up %s: %w", path, err)}
+		}
+		result.report = fmt.Sprintf("Backup created: %s\n", backupFilename)
+	}
+	if target != path {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fileResult{err: fmt.Errorf("creating directory for %s: %w", target, err)}
+		}
+	}
+	if err := os.WriteFile(target, newContent, 0644); err != nil {
+		return fileResult{err: fmt.Errorf("updating %s: %w", target, err)}
+	}
+	logf("%s updated successfully!\n", target)
+	return result
+}
+
+// inputRoot returns the directory of the given path, or the path itself if
+// it is a directory
+func inputRoot(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("accessing %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return path, nil
+	}
+	return filepath.Dir(path), nil
+}
+
+// checkOutputDir refuses to write the converted files within the input
+// directory, over the input files or among the ones left to process
+func checkOutputDir(root, outputDir string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	if isWithin(absRoot, absOutputDir) {
+		return fmt.Errorf("output directory %s is within the input directory %s", outputDir, root)
+	}
+	return nil
+}
+
+// outputPath returns where to write the converted file in the output
+// directory, keeping its path relative to the input root
+func outputPath(root, path, outputDir string) string {
+	relativePath, err := filepath.Rel(root, path)
+	if err != nil {
+		relativePath = filepath.Base(path)
+	}
+	return filepath.Join(outputDir, relativePath)
+}
+
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// firstDifference returns the offset of the first byte that differs between
+// the two contents
+func firstDifference(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// position converts a byte offset in the content to a line and a column,
+// both starting at 1, with the column counted in characters
+func position(content []byte, offset int) (line, column int) {
+	before := content[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return bytes.Count(before, []byte("\n")) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// backupFile copies the file next to it, with a .bak extension, and
+// returns the name of the copy
+func backupFile(filename string) (string, error) {
+	backupFilename := filename + ".bak"
+	_, err := os.Stat(backupFilename)
+	if err == nil {
+		return "", fmt.Errorf("backup file already exists: %s", backupFilename)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(backupFilename, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return backupFilename, nil
+}
@@ -0,0 +1,262 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunDryRun(t *testing.T) {
+	content := []byte(`[Google](https://www.google.com)
+`)
+
+	filename := "test.md"
+	err := os.WriteFile(filename, content, 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	defer os.Remove(filename)
+
+	if summary, err := ConvertFilesInPath(filename, FileOptions{DryRun: true}); err != nil || summary.Changed != 1 {
+		t.Errorf("Expected ConvertFilesInPath to report changes, but got %+v, %v", summary, err)
+	}
+
+	newContent, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	compareResults(newContent, content, t)
+}
+
+func TestRunCheck(t *testing.T) {
+	content := []byte(`# Title
+
+See [Google](https://www.google.com)
+`)
+
+	filename := "test.md"
+	err := os.WriteFile(filename, content, 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	defer os.Remove(filename)
+
+	if summary, err := ConvertFilesInPath(filename, FileOptions{Check: true, Backup: true}); err != nil || summary.Changed != 1 {
+		t.Errorf("Expected ConvertFilesInPath to report changes, but got %+v, %v", summary, err)
+	}
+
+	newContent, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	compareResults(newContent, content, t)
+	if _, err := os.Stat(filename + ".bak"); !os.IsNotExist(err) {
+		os.Remove(filename + ".bak")
+		t.Errorf("Expected no backup file to be created")
+	}
+}
+
+func TestConvertStream(t *testing.T) {
+	input := strings.NewReader(`See [Google](https://www.google.com)`)
+	expectedOutput := []byte(`See [Google][1]
+
+[1]: https://www.google.com
+`)
+
+	var output bytes.Buffer
+	if err := ConvertStream(input, &output, Options{}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	compareResults(output.Bytes(), expectedOutput, t)
+
+	output.Reset()
+	if err := InlineStream(bytes.NewReader(expectedOutput), &output, Options{}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	compareResults(output.Bytes(), []byte("See [Google](https://www.google.com)\n"), t)
+}
+
+func TestPosition(t *testing.T) {
+	content := []byte("first line\nżółw [Google](https://www.google.com)\n")
+	line, column := position(content, firstDifference(content, []byte("first line\nżółw [Google][1]\n")))
+
+	if line != 2 || column != 14 {
+		t.Errorf("Expected position 2:14, but got %d:%d", line, column)
+	}
+}
+
+func TestConvertFilesInPathErrors(t *testing.T) {
+	t.Run("reports missing paths", func(t *testing.T) {
+		summary, err := ConvertFilesInPath(filepath.Join(t.TempDir(), "missing.md"), FileOptions{})
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected a not exist error, but got %v", err)
+		}
+		if summary != (Summary{Failed: 1}) {
+			t.Errorf("Expected one failed file, but got %+v", summary)
+		}
+	})
+
+	t.Run("doesn't overwrite files when the backup fails", func(t *testing.T) {
+		dir := t.TempDir()
+		content := []byte("[Google](https://www.google.com)\n")
+		writeTestFile(t, filepath.Join(dir, "a.md"), content)
+		writeTestFile(t, filepath.Join(dir, "a.md.bak"), []byte("old backup"))
+		writeTestFile(t, filepath.Join(dir, "b.md"), content)
+
+		summary, err := ConvertFilesInPath(dir, FileOptions{Backup: true})
+
+		if err == nil || !strings.Contains(err.Error(), "backup file already exists") {
+			t.Errorf("Expected a backup error, but got %v", err)
+		}
+		if summary != (Summary{Processed: 2, Changed: 1, Failed: 1}) {
+			t.Errorf("Expected two processed files, one changed and one failed, but got %+v", summary)
+		}
+		compareResults(readTestFile(t, filepath.Join(dir, "a.md")), content, t)
+		compareResults(readTestFile(t, filepath.Join(dir, "b.md.bak")), content, t)
+	})
+}
+
+func TestConvertFilesInPathOutputDir(t *testing.T) {
+	t.Run("mirrors the input tree", func(t *testing.T) {
+		input, output := t.TempDir(), t.TempDir()
+		content := []byte("[Google](https://www.google.com)\n")
+		unchanged := []byte("Nothing to convert\n")
+		writeTestFile(t, filepath.Join(input, "a.md"), content)
+		writeTestFile(t, filepath.Join(input, "docs", "nested", "b.md"), unchanged)
+		writeTestFile(t, filepath.Join(input, "docs", "image.png"), []byte("not markdown"))
+
+		summary, err := ConvertFilesInPath(input, FileOptions{OutputDir: output})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if summary != (Summary{Processed: 2, Changed: 1}) {
+			t.Errorf("Expected two processed files and one changed, but got %+v", summary)
+		}
+
+		compareResults(readTestFile(t, filepath.Join(input, "a.md")), content, t)
+		compareResults(readTestFile(t, filepath.Join(output, "a.md")), []byte("[Google][1]\n\n[1]: https://www.google.com\n"), t)
+		compareResults(readTestFile(t, filepath.Join(output, "docs", "nested", "b.md")), unchanged, t)
+		if _, err := os.Stat(filepath.Join(output, "docs", "image.png")); !os.IsNotExist(err) {
+			t.Errorf("Expected files other than Markdown not to be copied")
+		}
+	})
+
+	t.Run("writes a single file to the output directory", func(t *testing.T) {
+		input, output := t.TempDir(), t.TempDir()
+		writeTestFile(t, filepath.Join(input, "a.md"), []byte("[Google](https://www.google.com)\n"))
+
+		if _, err := ConvertFilesInPath(filepath.Join(input, "a.md"), FileOptions{OutputDir: output}); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		readTestFile(t, filepath.Join(output, "a.md"))
+	})
+
+	t.Run("refuses to write in a subdirectory of the input directory", func(t *testing.T) {
+		input := t.TempDir()
+		output := filepath.Join(input, "docs", "sub")
+		content := []byte("[Google](https://www.google.com)\n")
+		writeTestFile(t, filepath.Join(input, "docs", "a.md"), content)
+		writeTestFile(t, filepath.Join(output, "b.md"), content)
+
+		summary, err := ConvertFilesInPath(filepath.Join(input, "docs"), FileOptions{OutputDir: output})
+		if err == nil || !strings.Contains(err.Error(), "within the input directory") {
+			t.Errorf("Expected an error about the output directory, but got %v", err)
+		}
+		if summary.Processed != 0 {
+			t.Errorf("Expected no processed file, but got %+v", summary)
+		}
+		compareResults(readTestFile(t, filepath.Join(output, "b.md")), content, t)
+		if _, err := os.Stat(filepath.Join(output, "a.md")); !os.IsNotExist(err) {
+			t.Errorf("Expected no file to be written in the input directory")
+		}
+	})
+
+	t.Run("refuses to write into the input directory", func(t *testing.T) {
+		input := t.TempDir()
+		content := []byte("[Google](https://www.google.com)\n")
+		writeTestFile(t, filepath.Join(input, "a.md"), content)
+
+		if _, err := ConvertFilesInPath(filepath.Join(input, "a.md"), FileOptions{OutputDir: input}); err == nil {
+			t.Errorf("Expected an error, but got none")
+		}
+		compareResults(readTestFile(t, filepath.Join(input, "a.md")), content, t)
+	})
+}
+
+func TestConvertFilesInPathsReportsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	var paths, expected []string
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.md", i))
+		// The first files are the longest, for the workers to finish the
+		// later ones first
+		content := strings.Repeat("Some text.\n", (50-i)*200) + "[Google](https://www.google.com)\n"
+		writeTestFile(t, path, []byte(content))
+		paths = append(paths, path)
+		expected = append(expected, fmt.Sprintf("%s:%d:9: needs to be converted", path, (50-i)*200+1))
+	}
+	paths = append(paths, filepath.Join(dir, "missing.md"))
+
+	var output bytes.Buffer
+	summary, err := ConvertFilesInPaths(paths, FileOptions{Jobs: 8, Check: true, Output: &output})
+
+	if summary != (Summary{Processed: 50, Changed: 50, Failed: 1}) {
+		t.Errorf("Expected 50 processed and changed files and one failed, but got %+v", summary)
+	}
+	if err == nil || !strings.Contains(err.Error(), "missing.md") {
+		t.Errorf("Expected an error about the missing file, but got %v", err)
+	}
+	if output.String() != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("Expected the files to be reported in order, but got:\n%s", output.String())
+	}
+}
+
+func BenchmarkConvertFilesInPath(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 200; i++ {
+		filename := filepath.Join(dir, fmt.Sprintf("section%d", i%10), fmt.Sprintf("%d.md", i))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filename, benchmarkDocument(50), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, jobs := range []int{1, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			output := b.TempDir()
+			for i := 0; i < b.N; i++ {
+				if _, err := ConvertFilesInPath(dir, FileOptions{Jobs: jobs, OutputDir: output}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, filename string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, filename string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	return content
+}
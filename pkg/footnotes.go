@@ -0,0 +1,245 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FootnotePolicy tells how footnotes are converted
+type FootnotePolicy string
+
+const (
+	// FootnotesKeep leaves footnotes as they are
+	FootnotesKeep FootnotePolicy = "keep"
+	// FootnotesReference converts inline footnotes (^[text]) to referenced
+	// ones and renumbers the numeric footnotes in order of appearance
+	FootnotesReference FootnotePolicy = "reference"
+)
+
+// ParseFootnotePolicy returns the footnote policy with the given name
+func ParseFootnotePolicy(name string) (FootnotePolicy, error) {
+	switch policy := FootnotePolicy(name); policy {
+	case FootnotesKeep, FootnotesReference:
+		return policy, nil
+	case "":
+		return FootnotesKeep, nil
+	}
+	return "", fmt.Errorf("unknown footnote policy %q, expected keep or reference", name)
+}
+
+// footnoteNumbers holds the new IDs of the footnotes, by normalized previous
+// label for the referenced ones and by position for the inline ones
+type footnoteNumbers struct {
+	labels map[string]string
+	inline map[int]string
+}
+
+// convertFootnotes adds the inline footnotes to the links and gives them and
+// the numeric footnotes numbers following the order in which they appear.
+// Footnotes that are never referenced come last, named footnotes and
+// references to footnotes defined nowhere keep their labels.
+func (c *MarkdownConverter) convertFootnotes(doc *document) footnoteNumbers {
+	numbers := footnoteNumbers{labels: make(map[string]string), inline: make(map[int]string)}
+
+	defined := make(map[string]int)
+	for i, link := range c.Links {
+		if link.IsFootnote() && isNumericID(link.ID[1:]) {
+			defined[normalizeLabel(link.ID)] = i
+		}
+	}
+	reserved := make(map[int]bool)
+	var footnotes []linkNode
+	for _, l := range doc.links {
+		reserveNumber(doc.source, l, defined, reserved)
+		switch l.kind {
+		case footnoteReference:
+			footnotes = append(footnotes, l)
+		case inlineFootnote:
+			if !staysInline(doc, l) {
+				footnotes = append(footnotes, l)
+			}
+		}
+	}
+	// The text of the footnotes is part of the document too
+	for _, d := range doc.definitions {
+		if d.isFootnote() {
+			text := parseDocument([]byte(d.destination))
+			for _, l := range text.links {
+				reserveNumber(text.source, l, defined, reserved)
+			}
+		}
+	}
+	sort.SliceStable(footnotes, func(i, j int) bool {
+		return footnotes[i].start < footnotes[j].start
+	})
+
+	number := 0
+	nextID := func() string {
+		number++
+		for reserved[number] {
+			number++
+		}
+		return "^" + strconv.Itoa(number)
+	}
+	seen := make(map[int]bool)
+	var renumbered []Link
+	for _, l := range footnotes {
+		if l.kind == inlineFootnote {
+			id := nextID()
+			numbers.inline[l.start] = id
+			renumbered = append(renumbered, Link{ID: id, URL: footnoteText(doc.source[l.text.start:l.text.end])})
+			continue
+		}
+		if i, ok := defined[normalizeLabel(l.label)]; ok && !seen[i] {
+			seen[i] = true
+			numbers.labels[normalizeLabel(l.label)] = nextID()
+		}
+	}
+
+	var unused []int
+	for _, i := range defined {
+		if !seen[i] {
+			unused = append(unused, i)
+		}
+	}
+	sort.Slice(unused, func(a, b int) bool {
+		return naturalLess(c.Links[unused[a]].ID, c.Links[unused[b]].ID)
+	})
+	for _, i := range unused {
+		numbers.labels[normalizeLabel(c.Links[i].ID)] = nextID()
+	}
+
+	for label, i := range defined {
+		c.Links[i].ID = numbers.labels[label]
+	}
+	c.Links = append(c.Links, renumbered...)
+	// The IDs of the links changed
+	c.index = nil
+	return numbers
+}
+
+// reserveNumber reserves the number of the footnote the link references, if
+// it is defined nowhere, so that no other footnote is given it. Text like
+// [^1] would reference the footnote given its number too.
+func reserveNumber(source []byte, l linkNode, defined map[string]int, reserved map[int]bool) {
+	label := ""
+	switch {
+	case l.kind == footnoteReference:
+		if _, ok := defined[normalizeLabel(l.label)]; !ok {
+			label = normalizeLabel(l.label)
+		}
+	case l.kind != inlineFootnote && !l.image:
+		label = normalizeLabel(string(source[l.text.start:l.text.end]))
+	}
+	if strings.HasPrefix(label, "^") && isNumericID(label[1:]) {
+		number, _ := strconv.Atoi(label[1:])
+		reserved[number] = true
+	}
+}
+
+// staysInline tells if the inline footnote must not be converted, as the
+// reference in its place or its text in a definition would read differently
+func staysInline(doc *document, l linkNode) bool {
+	text := doc.source[l.text.start:l.text.end]
+	if isBlank(text) {
+		return true
+	}
+	// The lines after the footnote may close what its text leaves open
+	if leavesInlineOpen(text) {
+		return true
+	}
+	if readAsImage(doc.source, l) || readAsDefinition(doc.source, l) || doc.opensDestination(l.start) {
+		return true
+	}
+	return nestsInlineFootnote(text) || textEndsDefinition(text)
+}
+
+// readAsImage tells if the reference in place of the footnote would follow
+// an exclamation mark, making an image of it
+func readAsImage(source []byte, l linkNode) bool {
+	return l.start > 0 && source[l.start-1] == '!'
+}
+
+// readAsDefinition tells if the reference in place of the footnote would be
+// part of a definition, like its label or its destination
+func readAsDefinition(source []byte, l linkNode) bool {
+	if followsLabel(source, l.start) {
+		return true
+	}
+	start := lineStart(source, l.start)
+	if len(bytes.Trim(source[start:l.start], " \t")) == 0 && l.end < len(source) && source[l.end] == ':' {
+		return true
+	}
+	// The line as it would be with the reference
+	line := append(append([]byte{}, source[start:l.start]...), "[^1]"...)
+	line = append(line, trimLineEnding(source[l.end:lineEnd(source, l.end)])...)
+	_, line = quoteMarkers(line)
+	return isDefinition(line)
+}
+
+// nestsInlineFootnote tells if the text holds what would be another inline
+// footnote once in a definition
+func nestsInlineFootnote(text []byte) bool {
+	for _, nested := range parseDocument(text).links {
+		if nested.kind == inlineFootnote {
+			return true
+		}
+	}
+	return false
+}
+
+// textEndsDefinition tells if a line of the text would end its definition,
+// reading as a definition of its own
+func textEndsDefinition(text []byte) bool {
+	for _, line := range strings.Split(footnoteText(text), "\n")[1:] {
+		if isDefinition([]byte(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// footnoteText returns the text of an inline footnote as the text of a
+// footnote definition, with the lines following the first one indented
+func footnoteText(text []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(text)), "\n")
+	lines[0] = strings.TrimSpace(lines[0])
+	for i := 1; i < len(lines); i++ {
+		lines[i] = "    " + strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moveFootnoteEdits replaces the converted inline footnotes with references
+// to their definitions. The edits made within a footnote are applied to the
+// text of its definition instead.
+func (c *MarkdownConverter) moveFootnoteEdits(doc *document, edits []edit) []edit {
+	for _, l := range doc.links {
+		id, ok := c.footnotes.inline[l.start]
+		if !ok || l.kind != inlineFootnote {
+			continue
+		}
+
+		var inner, outer []edit
+		for _, e := range edits {
+			if e.start >= l.text.start && e.end <= l.text.end {
+				inner = append(inner, edit{span: span{e.start - l.text.start, e.end - l.text.start}, replacement: e.replacement})
+			} else {
+				outer = append(outer, e)
+			}
+		}
+		if len(inner) > 0 {
+			text := footnoteText(applyEdits(doc.source[l.text.start:l.text.end], inner))
+			for i := range c.Links {
+				if c.Links[i].ID == id {
+					c.Links[i].URL = text
+				}
+			}
+		}
+		edits = append(outer, edit{span: l.span, replacement: "[" + id + "]"})
+	}
+	return edits
+}
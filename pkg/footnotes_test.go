@@ -0,0 +1,129 @@
+package converter
+
+import "testing"
+
+func TestFootnotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   FootnotePolicy
+		content  string
+		expected string
+	}{
+		{
+			name:   "keeps named footnotes",
+			policy: FootnotesKeep,
+			content: `Text[^note] and another[^1].
+
+[^note]: A named one.
+[^1]: Same text.
+[^2]: Same text.
+
+More text[^2].
+`,
+			expected: `Text[^note] and another[^1].
+
+More text[^2].
+
+[^1]: Same text.
+[^2]: Same text.
+[^note]: A named one.
+`,
+		},
+		{
+			name:   "keeps footnotes spanning many lines",
+			policy: FootnotesKeep,
+			content: `Text[^1] and [link](https://example.com).
+
+[^1]: First line
+  continued here.
+
+    Second paragraph.
+
+More text.
+`,
+			expected: `Text[^1] and [link][1].
+
+More text.
+
+[1]: https://example.com
+
+[^1]: First line
+  continued here.
+
+    Second paragraph.
+`,
+		},
+		{
+			name:   "keeps inline footnotes",
+			policy: FootnotesKeep,
+			content: `Text^[An inline note about [Go](https://go.dev).] and [link](https://example.com).
+`,
+			expected: `Text^[An inline note about [Go][1].] and [link][2].
+
+[1]: https://go.dev
+[2]: https://example.com
+`,
+		},
+		{
+			name:   "keeps inline footnotes ending the destination of a definition",
+			policy: FootnotesReference,
+			content: `[a]:b^[ c]
+`,
+			expected: `[a]:b^[ c]
+`,
+		},
+		{
+			name:   "keeps inline footnotes with lines read as definitions",
+			policy: FootnotesReference,
+			content: `Text^[A note
+[go]: https://go.dev]
+`,
+			expected: `Text^[A note
+[go]: https://go.dev]
+`,
+		},
+		{
+			name:   "converts inline footnotes and renumbers footnotes",
+			policy: FootnotesReference,
+			content: `First[^2] then^[An inline note
+  about [Go](https://go.dev).] and [^named] and again[^2] and [^9].
+
+[^2]: The second footnote.
+[^5]: Never used.
+[^named]: Named.
+`,
+			expected: `First[^1] then[^2] and [^named] and again[^1] and [^9].
+
+[1]: https://go.dev
+
+[^1]: The second footnote.
+[^2]: An inline note
+    about [Go][1].
+[^3]: Never used.
+[^named]: Named.
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compareConvertResultsWithOptions(t, Options{Footnotes: test.policy}, []byte(test.content), []byte(test.expected))
+		})
+	}
+}
+
+func TestParseFootnoteDefinitions(t *testing.T) {
+	content := []byte("[^1]: First\n  second\n\n    Third\n\nNot in the footnote\n[^2]: Other\n\n  not indented enough\n")
+
+	doc := parseDocument(content)
+
+	if len(doc.definitions) != 2 {
+		t.Fatalf("Expected 2 definitions, but got %+v", doc.definitions)
+	}
+	if text := doc.definitions[0].destination; text != "First\n  second\n\n    Third" {
+		t.Errorf("Expected the text of the first footnote to span the indented lines, but got %q", text)
+	}
+	if text := doc.definitions[1].destination; text != "Other" {
+		t.Errorf("Expected the text of the second footnote to be one line, but got %q", text)
+	}
+}
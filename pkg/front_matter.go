@@ -0,0 +1,113 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// byteOrderMark may precede the front matter
+var byteOrderMark = []byte("\xef\xbb\xbf")
+
+// frontMatterSettings are the settings of a document, given in its YAML
+// front matter under the markdown-tools key:
+//
+//	---
+//	title: Notes
+//	markdown-tools:
+//	  skip: true
+//	---
+//
+// Only the settings of the conversion of a single document are accepted,
+// named as in a configuration file.
+type frontMatterSettings struct {
+	// Skip leaves the document as it is
+	Skip bool `yaml:"skip"`
+	// The other settings are the ones of Config
+	IDs          IDStrategy     `yaml:"ids"`
+	Placement    Placement      `yaml:"placement"`
+	SectionLevel *int           `yaml:"section-level"`
+	Images       ImagePolicy    `yaml:"images"`
+	Autolinks    AutolinkPolicy `yaml:"autolinks"`
+	Footnotes    FootnotePolicy `yaml:"footnotes"`
+	Renumber     *bool          `yaml:"renumber"`
+}
+
+// config returns the settings as the ones of a configuration file
+func (s frontMatterSettings) config() Config {
+	return Config{
+		IDs:          s.IDs,
+		Placement:    s.Placement,
+		SectionLevel: s.SectionLevel,
+		Images:       s.Images,
+		Autolinks:    s.Autolinks,
+		Footnotes:    s.Footnotes,
+		Renumber:     s.Renumber,
+	}
+}
+
+// splitFrontMatter returns the YAML (between --- lines) or TOML (between
+// +++ lines) front matter opening the content, with its delimiters and the
+// line ending of the closing one, and the rest of the content. YAML front
+// matter may also be closed by a ... line.
+func splitFrontMatter(content []byte) (frontMatter, body []byte) {
+	start := 0
+	if bytes.HasPrefix(content, byteOrderMark) {
+		start = len(byteOrderMark)
+	}
+	end := lineEnd(content, start)
+	delimiter := string(bytes.TrimRight(trimLineEnding(content[start:end]), " \t"))
+	if delimiter != "---" && delimiter != "+++" {
+		return nil, content
+	}
+
+	for pos := end; pos < len(content); {
+		next := lineEnd(content, pos)
+		line := string(bytes.TrimRight(trimLineEnding(content[pos:next]), " \t"))
+		if line == delimiter || (delimiter == "---" && line == "...") {
+			return content[:next], content[next:]
+		}
+		pos = next
+	}
+	// Without a closing line, it is a thematic break or a setext heading
+	return nil, content
+}
+
+// parseFrontMatterSettings returns the settings found in the front matter.
+// Only YAML front matter can hold settings, and front matter that isn't
+// valid YAML is left to the tools it is meant for. Unknown settings are
+// reported, like in configuration files.
+func parseFrontMatterSettings(frontMatter []byte) (frontMatterSettings, error) {
+	var settings frontMatterSettings
+	frontMatter = bytes.TrimPrefix(frontMatter, byteOrderMark)
+	if !bytes.HasPrefix(frontMatter, []byte("---")) {
+		return settings, nil
+	}
+	// The delimiters are YAML document markers, only the one inside matters
+	start := lineEnd(frontMatter, 0)
+	end := bytes.LastIndexByte(bytes.TrimRight(frontMatter, "\r\n"), '\n') + 1
+
+	var values struct {
+		Settings yaml.Node `yaml:"markdown-tools"`
+	}
+	if err := yaml.Unmarshal(frontMatter[start:end], &values); err != nil || values.Settings.IsZero() {
+		return settings, nil
+	}
+	// The other keys are left to the other tools, and the opening delimiter
+	// is kept for the lines to be counted from the start of the document
+	var strict struct {
+		Settings *frontMatterSettings `yaml:"markdown-tools"`
+		Others   map[string]yaml.Node `yaml:",inline"`
+	}
+	strict.Settings = &settings
+	decoder := yaml.NewDecoder(bytes.NewReader(frontMatter[:end]))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&strict); err != nil {
+		return settings, fmt.Errorf("front matter: %w", err)
+	}
+	if err := settings.config().validate(); err != nil {
+		return settings, fmt.Errorf("front matter: %w", err)
+	}
+	return settings, nil
+}
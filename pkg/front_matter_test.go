@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		frontMatter string
+	}{
+		{"YAML", "---\ntitle: Notes\n---\n# Notes\n", "---\ntitle: Notes\n---\n"},
+		{"YAML closed with dots", "---\ntitle: Notes\n...\n# Notes\n", "---\ntitle: Notes\n...\n"},
+		{"TOML", "+++\ntitle = \"Notes\"\n+++\r\n# Notes\n", "+++\ntitle = \"Notes\"\n+++\r\n"},
+		{"after a byte order mark", "\xef\xbb\xbf---\ntitle: Notes\n---\n", "\xef\xbb\xbf---\ntitle: Notes\n---\n"},
+		{"mismatched delimiters", "---\ntitle: Notes\n+++\n# Notes\n", ""},
+		{"not at the beginning", "\n---\ntitle: Notes\n---\n", ""},
+		{"thematic break", "---\n\nText\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frontMatter, body := splitFrontMatter([]byte(test.content))
+			if string(frontMatter) != test.frontMatter {
+				t.Errorf("Expected the front matter %q, but got %q", test.frontMatter, frontMatter)
+			}
+			if string(frontMatter)+string(body) != test.content {
+				t.Errorf("Expected the front matter and the body to make the content, but got %q and %q", frontMatter, body)
+			}
+		})
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name: "keeps YAML front matter as it is",
+			content: `---
+title: "[Go](https://go.dev)"
+links:
+  - "[foo]: bar"
+
+
+
+---
+
+[Go](https://go.dev)
+`,
+			expected: `---
+title: "[Go](https://go.dev)"
+links:
+  - "[foo]: bar"
+
+
+
+---
+
+[Go][1]
+
+[1]: https://go.dev
+`,
+		},
+		{
+			name: "keeps TOML front matter as it is",
+			content: `+++
+title = "[Go](https://go.dev)"
++++
+[Go](https://go.dev)
+`,
+			expected: `+++
+title = "[Go](https://go.dev)"
++++
+[Go][1]
+
+[1]: https://go.dev
+`,
+		},
+		{
+			name:     "keeps documents made of front matter only",
+			content:  "---\ntitle: Notes\n---",
+			expected: "---\ntitle: Notes\n---",
+		},
+		{
+			name: "skips documents that ask for it",
+			content: `---
+markdown-tools: {skip: true}
+---
+[Go](https://go.dev)
+`,
+			expected: `---
+markdown-tools: {skip: true}
+---
+[Go](https://go.dev)
+`,
+		},
+		{
+			name: "uses the settings of the front matter",
+			content: `---
+markdown-tools:
+  ids: slug
+---
+[Go](https://go.dev)
+`,
+			expected: `---
+markdown-tools:
+  ids: slug
+---
+[Go][go]
+
+[go]: https://go.dev
+`,
+		},
+		{
+			name: "converts links after an unclosed delimiter",
+			content: `---
+[Go](https://go.dev)
+`,
+			expected: `---
+[Go][1]
+
+[1]: https://go.dev
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compareConvertResultsWithOptions(t, Options{}, []byte(test.content), []byte(test.expected))
+		})
+	}
+
+	t.Run("reports invalid settings", func(t *testing.T) {
+		_, _, err := NewConverter(Options{}).convert([]byte("---\nmarkdown-tools:\n  placement: top\n---\n[Go](https://go.dev)\n"))
+		if err == nil || !strings.Contains(err.Error(), `unknown placement "top"`) {
+			t.Errorf("Expected an error about the placement, but got %v", err)
+		}
+	})
+
+	t.Run("reports unknown settings", func(t *testing.T) {
+		for _, setting := range []string{"idz: slug", "exclude: [drafts]"} {
+			_, _, err := NewConverter(Options{}).convert([]byte("---\ntitle: Notes\nmarkdown-tools:\n  " + setting + "\n---\n[Go](https://go.dev)\n"))
+			if field := strings.SplitN(setting, ":", 2)[0]; err == nil || !strings.Contains(err.Error(), "line 4: field "+field+" not found") {
+				t.Errorf("Expected an error about %s on line 4, but got %v", field, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignore holds the patterns of the .gitignore files found so far,
+// in the order git applies them: the deeper and the later, the stronger
+type gitignore struct {
+	// base is the top directory all patterns are relative to, usually the
+	// root of the git repository
+	base     string
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	// dir is the directory of the .gitignore file, relative to the base
+	dir      string
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// newGitignore loads the .gitignore files from the root of the git
+// repository containing the given directory down to the directory itself
+func newGitignore(dir string) (*gitignore, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := &gitignore{base: findRepositoryRoot(absDir)}
+
+	var dirs []string
+	for d := absDir; ; d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+		if d == g.base || d == filepath.Dir(d) {
+			break
+		}
+	}
+	for _, d := range dirs {
+		if err := g.load(d); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// findRepositoryRoot returns the closest directory containing .git, or the
+// directory itself if it isn't in a git repository
+func findRepositoryRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if d == filepath.Dir(d) {
+			return dir
+		}
+	}
+}
+
+// load adds the patterns of the .gitignore file in the given directory, if any
+func (g *gitignore) load(dir string) error {
+	content, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	relativeDir, err := g.relative(dir)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(scanner.Text()); ok {
+			p.dir = relativeDir
+			g.patterns = append(g.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash anywhere but at the end anchors the pattern to its directory
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	p.glob = line
+	return p, line != ""
+}
+
+// ignored tells if git ignores the file or directory at the given path
+func (g *gitignore) ignored(name string, isDir bool) bool {
+	relativePath, err := g.relative(name)
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	for _, p := range g.patterns {
+		if p.matches(relativePath, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p *ignorePattern) matches(relativePath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.dir != "" {
+		if !strings.HasPrefix(relativePath, p.dir+"/") {
+			return false
+		}
+		relativePath = relativePath[len(p.dir)+1:]
+	}
+	if p.anchored {
+		return matchGlob(p.glob, relativePath)
+	}
+	return matchGlob(p.glob, path.Base(relativePath))
+}
+
+// relative returns the slash-separated path relative to the base
+func (g *gitignore) relative(name string) (string, error) {
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	relativePath, err := filepath.Rel(g.base, absName)
+	if err != nil {
+		return "", err
+	}
+	if relativePath == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(relativePath), nil
+}
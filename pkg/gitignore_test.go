@@ -0,0 +1,73 @@
+package converter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	tests := []struct {
+		line  string
+		valid bool
+		want  ignorePattern
+	}{
+		{"# comment", false, ignorePattern{}},
+		{"   ", false, ignorePattern{}},
+		{"*.md", true, ignorePattern{glob: "*.md"}},
+		{"!keep.md", true, ignorePattern{glob: "keep.md", negate: true}},
+		{"build/", true, ignorePattern{glob: "build", dirOnly: true}},
+		{"/docs/drafts", true, ignorePattern{glob: "docs/drafts", anchored: true}},
+		{`\#hash.md`, true, ignorePattern{glob: "#hash.md"}},
+	}
+
+	for _, test := range tests {
+		p, ok := parseIgnorePattern(test.line)
+		if ok != test.valid {
+			t.Errorf("Expected %q to be a pattern: %v, but got %v", test.line, test.valid, ok)
+			continue
+		}
+		if p != test.want {
+			t.Errorf("Expected %q to be parsed as %+v, but got %+v", test.line, test.want, p)
+		}
+	}
+}
+
+func TestConvertFilesInPathGitignore(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("[Google](https://www.google.com)\n")
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"))
+	writeTestFile(t, filepath.Join(dir, ".gitignore"), []byte("build/\n*.generated.md\n!keep.generated.md\n"))
+	writeTestFile(t, filepath.Join(dir, "docs", ".gitignore"), []byte("/drafts\n"))
+	for _, name := range []string{
+		"README.md",
+		"build/out.md",
+		"api.generated.md",
+		"keep.generated.md",
+		"docs/guide.md",
+		"docs/api.generated.md",
+		"docs/drafts/draft.md",
+		"drafts/not_ignored.md",
+	} {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+
+	t.Run("skips ignored files", func(t *testing.T) {
+		summary, err := ConvertFilesInPath(dir, FileOptions{Check: true, Gitignore: true})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if summary.Processed != 4 {
+			t.Errorf("Expected 4 processed files, but got %d", summary.Processed)
+		}
+	})
+
+	t.Run("reads .gitignore files above the given path", func(t *testing.T) {
+		summary, err := ConvertFilesInPath(filepath.Join(dir, "docs"), FileOptions{Check: true, Gitignore: true})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if summary.Processed != 1 {
+			t.Errorf("Expected 1 processed file, but got %d", summary.Processed)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// IDStrategy tells how the IDs of new references are chosen
+type IDStrategy string
+
+const (
+	// IDsNumeric uses the lowest free number: [1], [2], ...
+	IDsNumeric IDStrategy = "numeric"
+	// IDsSlug derives the ID from the link text: [Google][google]
+	IDsSlug IDStrategy = "slug"
+	// IDsDomain numbers the links to each domain: [github-com-1]
+	IDsDomain IDStrategy = "domain"
+	// IDsHash uses a short hash of the URL, stable across runs: [3f2a9c1]
+	IDsHash IDStrategy = "hash"
+)
+
+// ParseIDStrategy returns the ID strategy with the given name
+func ParseIDStrategy(name string) (IDStrategy, error) {
+	switch strategy := IDStrategy(name); strategy {
+	case IDsNumeric, IDsSlug, IDsDomain, IDsHash:
+		return strategy, nil
+	case "":
+		return IDsNumeric, nil
+	}
+	return "", fmt.Errorf("unknown ID strategy %q, expected numeric, slug, domain or hash", name)
+}
+
+// maxSlugLength keeps IDs derived from long link texts readable
+const maxSlugLength = 40
+
+// hashLength is the number of hex digits of the hash used as ID
+const hashLength = 7
+
+// newID returns a free ID for the link. IDs already used get a numeric
+// suffix, the domain strategy always adds one.
+func (x *linkIndex) newID(link Link, strategy IDStrategy) string {
+	var base string
+	switch strategy {
+	case IDsSlug:
+		base = slug(link.Name)
+	case IDsDomain:
+		base = domainID(link.URL)
+	case IDsHash:
+		sum := sha256.Sum256([]byte(link.URL))
+		base = hex.EncodeToString(sum[:])[:hashLength]
+	default:
+		for x.numbers[x.next] || x.taken[strconv.Itoa(x.next)] {
+			x.next++
+		}
+		return strconv.Itoa(x.next)
+	}
+
+	// Numeric IDs would be taken for the numbered ones and renumbered
+	if base == "" {
+		base = "link"
+	} else if isNumericID(base) {
+		base = "link-" + base
+	}
+	n := 1
+	if strategy != IDsDomain {
+		if !x.used(base) {
+			return base
+		}
+		n = 2
+	}
+	for ; ; n++ {
+		if id := base + "-" + strconv.Itoa(n); !x.used(id) {
+			return id
+		}
+	}
+}
+
+func (x *linkIndex) used(id string) bool {
+	_, ok := x.ids[normalizeLabel(id)]
+	return ok || x.taken[normalizeLabel(id)]
+}
+
+// slug turns the text into a lowercase ID made of letters and digits
+// separated by dashes
+func slug(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	s := b.String()
+	if runes := []rune(s); len(runes) > maxSlugLength {
+		s = strings.TrimRight(string(runes[:maxSlugLength]), "-")
+	}
+	return s
+}
+
+// domainID returns the host of the URL as an ID, without the www prefix,
+// e.g. github-com for https://www.github.com/
+func domainID(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return slug(strings.TrimPrefix(u.Hostname(), "www."))
+}
@@ -0,0 +1,46 @@
+package converter
+
+import "testing"
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Google":                      "google",
+		"The Go Programming Language": "the-go-programming-language",
+		"  **Bold** & `code`!":        "bold-code",
+		"Zażółć gęślą jaźń":           "zażółć-gęślą-jaźń",
+		"![logo](logo.png)":           "logo-logo-png",
+		"...":                         "",
+		"A very long link text that goes on and on and on": "a-very-long-link-text-that-goes-on-and-o",
+	}
+	for text, expected := range tests {
+		if s := slug(text); s != expected {
+			t.Errorf("Expected the slug of %q to be %q, but got %q", text, expected, s)
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	c := MarkdownConverter{Links: []Link{{ID: "google", URL: "https://google.com"}, {ID: "github-com-1", URL: "https://github.com"}}}
+	index := c.buildIndex()
+
+	tests := []struct {
+		strategy IDStrategy
+		link     Link
+		expected string
+	}{
+		{IDsNumeric, Link{URL: "https://example.com"}, "1"},
+		{IDsSlug, Link{Name: "Google", URL: "https://www.google.com"}, "google-2"},
+		{IDsSlug, Link{Name: "", URL: "https://example.com"}, "link"},
+		{IDsDomain, Link{URL: "https://www.github.com/lubieniebieski"}, "github-com-2"},
+		{IDsDomain, Link{URL: "https://example.com/"}, "example-com-1"},
+		{IDsDomain, Link{URL: "logo.png"}, "link-1"},
+		{IDsSlug, Link{Name: "2023", URL: "https://example.com/2023"}, "link-2023"},
+		{IDsHash, Link{URL: "https://example.com"}, "100680a"},
+		{IDsHash, Link{URL: "https://e.com/2"}, "link-5117555"},
+	}
+	for _, test := range tests {
+		if id := index.newID(test.link, test.strategy); id != test.expected {
+			t.Errorf("Expected the %s ID of %+v to be %q, but got %q", test.strategy, test.link, test.expected, id)
+		}
+	}
+}
@@ -6,10 +6,28 @@ import (
 	"strings"
 )
 
+var referenceIDRegex = regexp.MustCompile(`^\D+$`)
+
 type Link struct {
 	Name string
 	URL  string
 	ID   string
+	// Title is the link title as written, without the quotes or parentheses
+	// around it
+	Title string
+	// Image is true for the links used by images only
+	Image bool
+}
+
+// linkKey identifies the links that can share a definition
+type linkKey struct {
+	url   string
+	title string
+	image bool
+}
+
+func keyOf(l Link) linkKey {
+	return linkKey{l.URL, l.Title, l.Image}
 }
 
 func (l *Link) IsFootnote() bool {
@@ -17,20 +35,118 @@ func (l *Link) IsFootnote() bool {
 }
 
 func (l *Link) IsReference() bool {
-	match, _ := regexp.MatchString(`^\D+$`, l.ID)
-	return match && !l.IsFootnote()
+	return referenceIDRegex.MatchString(l.ID) && !l.IsFootnote()
 }
 
 func (l *Link) AsReference() string {
-	return fmt.Sprintf("[%s]: %s", l.ID, l.URL)
+	if l.IsFootnote() {
+		return fmt.Sprintf("[%s]: %s", l.ID, l.URL)
+	}
+	return fmt.Sprintf("[%s]: %s", l.ID, strings.TrimSuffix(l.target(), " "))
 }
 
 func (l *Link) AsMarkdownLink() string {
 	if l.URL == "" {
 		return l.Name
 	}
-	if l.Name == "" {
+	if l.Name == "" && l.Title == "" {
 		return fmt.Sprintf("<%s>", l.URL)
 	}
-	return fmt.Sprintf("[%s](%s)", l.Name, l.URL)
+	return fmt.Sprintf("[%s](%s)", l.Name, l.target())
+}
+
+// target returns the destination of the link followed by its title, as
+// written in definitions and inline links
+func (l *Link) target() string {
+	if l.Title == "" && endsWithBackslash(l.URL) {
+		// Followed by the closing parenthesis, the backslash would escape it
+		return formatDestination(l.URL) + " "
+	}
+	if l.Title == "" {
+		return formatDestination(l.URL)
+	}
+	return formatDestination(l.URL) + " " + formatTitle(l.Title)
+}
+
+// escapeLinkText escapes the characters that would end the text of a link
+func escapeLinkText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(text)
+}
+
+// formatDestination puts the destination in angle brackets when it couldn't
+// be written without them
+func formatDestination(url string) string {
+	depth := 0
+	for i := 0; i < len(url); i++ {
+		switch c := url[i]; {
+		case c == '\\' && i+1 < len(url) && isPunctuation(url[i+1]):
+			i++
+		case c <= ' ' || c == '<' && i == 0:
+			return angleBrackets(url)
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return angleBrackets(url)
+			}
+			depth--
+		}
+	}
+	if url == "" || depth != 0 {
+		return angleBrackets(url)
+	}
+	return url
+}
+
+// angleBrackets puts the destination in angle brackets. A backslash escaping
+// nothing at its end would escape the closing bracket, so it is escaped.
+func angleBrackets(url string) string {
+	if endsWithBackslash(url) {
+		url += "\\"
+	}
+	return "<" + url + ">"
+}
+
+// endsWithBackslash tells if the text ends with a backslash escaping nothing
+func endsWithBackslash(text string) bool {
+	n := 0
+	for n < len(text) && text[len(text)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+// formatTitle puts the title in the first delimiters it doesn't contain,
+// escaping double quotes if it contains all of them
+func formatTitle(title string) string {
+	switch {
+	case !containsUnescaped(title, '"'):
+		return `"` + title + `"`
+	case !containsUnescaped(title, '\''):
+		return "'" + title + "'"
+	case !containsUnescaped(title, '(') && !containsUnescaped(title, ')'):
+		return "(" + title + ")"
+	}
+	var b strings.Builder
+	for i := 0; i < len(title); i++ {
+		if title[i] == '\\' && i+1 < len(title) {
+			b.WriteByte(title[i])
+			i++
+		} else if title[i] == '"' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(title[i])
+	}
+	return `"` + b.String() + `"`
+}
+
+func containsUnescaped(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == c {
+			return true
+		}
+	}
+	return false
 }
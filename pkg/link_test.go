@@ -2,6 +2,7 @@ package converter
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +44,40 @@ func TestAsReference(t *testing.T) {
 	}
 }
 
+func TestAsReferenceWithTitle(t *testing.T) {
+	tests := []struct {
+		link     Link
+		expected string
+	}{
+		{Link{ID: "1", URL: "http://example.com", Title: "Title"}, `[1]: http://example.com "Title"`},
+		{Link{ID: "1", URL: "http://example.com", Title: `Say "hi"`}, `[1]: http://example.com 'Say "hi"'`},
+		{Link{ID: "1", URL: "http://example.com", Title: `"It's"`}, `[1]: http://example.com ("It's")`},
+		{Link{ID: "1", URL: "http://example.com", Title: `"It's" (really)`}, `[1]: http://example.com "\"It's\" (really)"`},
+		{Link{ID: "1", URL: "http://example.com/a b"}, "[1]: <http://example.com/a b>"},
+		{Link{ID: "^1", URL: "some footnote"}, "[^1]: some footnote"},
+	}
+
+	for _, test := range tests {
+		if output := test.link.AsReference(); output != test.expected {
+			t.Errorf("Expected AsReference() to return %q, but got %q", test.expected, output)
+		}
+	}
+}
+
+func TestAsMarkdownLinkWithTitle(t *testing.T) {
+	link := Link{Name: "Example", URL: "http://example.com", Title: "Title"}
+	expected := `[Example](http://example.com "Title")`
+	if link.AsMarkdownLink() != expected {
+		t.Errorf("Expected AsMarkdownLink() to return %q, but got %q", expected, link.AsMarkdownLink())
+	}
+
+	link.Name = ""
+	expected = `[](http://example.com "Title")`
+	if link.AsMarkdownLink() != expected {
+		t.Errorf("Expected AsMarkdownLink() to return %q, but got %q", expected, link.AsMarkdownLink())
+	}
+}
+
 func TestAsMarkdownLink(t *testing.T) {
 	link := Link{URL: "http://example.com"}
 	expected := "<http://example.com>"
@@ -57,6 +92,25 @@ func TestAsMarkdownLink(t *testing.T) {
 	}
 }
 
+func TestAsMarkdownLinkWithBackslashes(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{`https://example.com/a\)b`, `[Example](https://example.com/a\)b)`},
+		{`C:\path\to\`, `[Example](C:\path\to\ )`},
+		{`C:\path\to\\`, `[Example](C:\path\to\\)`},
+		{`C:\My Documents`, `[Example](<C:\My Documents>)`},
+	}
+
+	for _, test := range tests {
+		link := Link{Name: "Example", URL: test.url}
+		if output := link.AsMarkdownLink(); output != test.expected {
+			t.Errorf("Expected AsMarkdownLink() to return %q, but got %q", test.expected, output)
+		}
+	}
+}
+
 func TestIsReferenceRegex(t *testing.T) {
 	link := Link{ID: "abc"}
 	match, _ := regexp.MatchString(`^\D+$`, link.ID)
@@ -70,3 +124,42 @@ func TestIsReferenceRegex(t *testing.T) {
 		t.Errorf("Expected ID %q to not match reference regex, but it did", link.ID)
 	}
 }
+
+// FuzzRewriteLinks checks that the inline links of any document, written
+// again as inline links or as definitions, keep their destination and title
+func FuzzRewriteLinks(f *testing.F) {
+	for _, seed := range []string{
+		"[Google](https://www.google.com)",
+		`[Go](https://go.dev "The \"Go\" site")`,
+		"[Wiki](https://en.wikipedia.org/wiki/Go_(programming_language))",
+		"[Query](https://example.com/?q=a+b*c&d=(e)|f$)",
+		"[Spaces](<https://example.com/url with spaces>)",
+		`[Escaped](https://example.com/a\)b 'it\'s')`,
+		"[Title](https://example.com (a (title)))",
+		"![Image](<image (1).png>)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		for _, l := range parseDocument([]byte(content)).links {
+			if l.kind != inlineLink || l.destination == "" {
+				continue
+			}
+			link := Link{Name: "text", URL: l.destination, ID: "1", Title: l.title}
+
+			rewritten := parseDocument([]byte(link.AsMarkdownLink()))
+			if len(rewritten.links) != 1 || rewritten.links[0].destination != l.destination || rewritten.links[0].title != l.title {
+				t.Errorf("Expected %q to keep the destination %q and the title %q, but got %+v", link.AsMarkdownLink(), l.destination, l.title, rewritten.links)
+			}
+			if strings.ContainsAny(l.title, "\r\n") {
+				// Such links stay inline, definitions take a single line
+				continue
+			}
+			reference := parseDocument([]byte(link.AsReference()))
+			if len(reference.definitions) != 1 || reference.definitions[0].destination != l.destination || reference.definitions[0].title != l.title {
+				t.Errorf("Expected %q to keep the destination %q and the title %q, but got %+v", link.AsReference(), l.destination, l.title, reference.definitions)
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package converter
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// pageTitleClient is used to fetch pages, with a timeout so that a slow
+// server doesn't stop the conversion
+var pageTitleClient = &http.Client{Timeout: 10 * time.Second}
+
+// PageTitle returns the title of the HTML page at the given URL, or an empty
+// string if it can't be fetched or has no title. It can be used as
+// Options.AutolinkText.
+func PageTitle(url string) string {
+	response, err := pageTitleClient.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(response.Header.Get("Content-Type"), "html") {
+		return ""
+	}
+
+	// The title is in the head, the beginning of the page is enough
+	page, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	match := titleRegex.FindSubmatch(page)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPageTitle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><head><TITLE lang=\"en\">\n  Tom &amp; Jerry\n</TITLE></head></html>")
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "<title>Not HTML</title>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := map[string]string{
+		"/page":    "Tom & Jerry",
+		"/text":    "",
+		"/missing": "",
+	}
+	for path, expected := range tests {
+		if title := PageTitle(server.URL + path); title != expected {
+			t.Errorf("Expected the title of %s to be %q, but got %q", path, expected, title)
+		}
+	}
+}
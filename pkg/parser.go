@@ -0,0 +1,1346 @@
+package converter
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// span is a half-open byte range [start, end) of the source document
+type span struct {
+	start int
+	end   int
+}
+
+type linkKind int
+
+const (
+	inlineLink             linkKind = iota // [text](url "title")
+	fullReferenceLink                      // [text][label]
+	collapsedReferenceLink                 // [label][]
+	shortcutReferenceLink                  // [label]
+	footnoteReference                      // [^label]
+	inlineFootnote                         // ^[text], as in Pandoc
+)
+
+// linkNode is a link (or an image) found in the prose of a document
+type linkNode struct {
+	span
+	kind  linkKind
+	image bool
+	// text is the link text, without the surrounding brackets
+	text        span
+	label       string
+	destination string
+	title       string
+}
+
+func (l *linkNode) isReference() bool {
+	return l.kind == fullReferenceLink || l.kind == collapsedReferenceLink || l.kind == shortcutReferenceLink
+}
+
+// definition is a link reference definition (`[label]: url "title"`) or
+// a footnote definition (`[^label]: text`), always spanning whole lines.
+// Footnote definitions go on with the indented lines following them.
+type definition struct {
+	span
+	label       string
+	destination string
+	// title is empty for footnotes, whose destination is their text
+	title string
+	// endsList is true if the definition ends a list, which the indented
+	// lines after it would otherwise go on
+	endsList bool
+}
+
+func (d *definition) isFootnote() bool {
+	return strings.HasPrefix(d.label, "^")
+}
+
+// autolink is a URL written as `<scheme:...>` or, as GFM allows, bare in the text
+type autolink struct {
+	span
+	url  string
+	bare bool
+}
+
+// heading is an ATX (`## Title`) or setext (`Title` underlined) heading,
+// spanning all its lines
+type heading struct {
+	span
+	level int
+}
+
+// document is a parsed Markdown source: the regions holding code, which must
+// never be touched, the definitions, the headings and the links found in the
+// prose
+type document struct {
+	source      []byte
+	code        []span
+	definitions []definition
+	headings    []heading
+	links       []linkNode
+	autolinks   []autolink
+	// bracketed are the texts in brackets that aren't links, but would be
+	// shortcut references if a definition used them as label
+	bracketed []string
+	// unclosed is the start of the code, HTML or math block running until
+	// the end of the document, or -1
+	unclosed int
+	// indents are the indentations of the paragraphs right after a
+	// definition, which would make code of them without the definition
+	indents []span
+	// destinations are the parts of the paragraphs within parentheses
+	// opened right after a link, like a link destination, in order
+	destinations []span
+}
+
+func parseDocument(source []byte) *document {
+	p := parser{doc: &document{source: source, unclosed: -1}, labels: make(map[string]bool)}
+	p.parseBlocks()
+	for _, d := range p.doc.definitions {
+		p.labels[normalizeLabel(d.label)] = true
+	}
+	for _, paragraph := range p.paragraphs {
+		p.parseInlines(paragraph, false)
+		p.findDestinations(paragraph)
+	}
+	return p.doc
+}
+
+type parser struct {
+	doc        *document
+	paragraphs []span
+	labels     map[string]bool
+	// inFootnote is set while parsing the text of an inline footnote,
+	// which cannot contain another one
+	inFootnote bool
+}
+
+type fence struct {
+	char   byte
+	length int
+	start  int
+	// indent is the indentation of the list item holding the fence
+	indent int
+	// quotes is the number of blockquotes holding the fence
+	quotes int
+}
+
+// rawBlock is an HTML or a math block, which is left as it is like code
+type rawBlock struct {
+	start int
+	// closing is the text of the line ending the block, the block ends
+	// before the next blank line if it is empty
+	closing string
+	// foldCase matches the closing text case-insensitively
+	foldCase bool
+	// quotes is the number of blockquotes holding the block
+	quotes int
+}
+
+// parseBlocks splits the source into lines and sorts them into code, HTML
+// and math blocks, definitions and paragraphs, which are parsed for inlines
+// later. The blocks of a line are read after its blockquote markers, and the
+// blocks open in blockquotes end with them.
+func (p *parser) parseBlocks() {
+	src := p.doc.source
+	var open *fence
+	var raw *rawBlock
+	paragraph := -1
+	// indented is the start of the indented code block being read, if any,
+	// indentedEnd the end of its last line that isn't blank, and indentedIn
+	// the indentation of the list item holding it
+	indented, indentedEnd, indentedIn := -1, -1, 0
+	// quoted is the number of blockquotes holding the blocks being read
+	quoted := 0
+	inList := false
+	emptyItem := false
+	// items are the indentations of the content of the list items the lines
+	// may belong to, the innermost last. The blocks of a line are read from
+	// the indentation of the item it belongs to. Indentation within lists is
+	// too often inconsistent to take a definition for code, so only the
+	// other lines start indented code there.
+	var items []int
+	// A definition goes on like a paragraph, which indented code cannot
+	// interrupt
+	inDefinition := false
+	flush := func(end int) {
+		if paragraph >= 0 {
+			p.paragraphs = append(p.paragraphs, span{paragraph, end})
+			paragraph = -1
+		}
+	}
+
+	for start := textStart(src); start < len(src); {
+		end := lineEnd(src, start)
+		text := trimLineEnding(src[start:end])
+		quotes, line := quoteMarkers(text)
+		width, _ := leadingIndent(line)
+
+		if quotes < quoted {
+			switch {
+			case open != nil:
+				p.doc.code = append(p.doc.code, span{open.start, start})
+				open = nil
+			case raw != nil:
+				p.doc.code = append(p.doc.code, span{raw.start, start})
+				raw = nil
+			}
+		}
+		if indented >= 0 && (quotes != quoted || (!isBlank(line) && width-indentedIn < 4)) {
+			p.doc.code = append(p.doc.code, span{indented, indentedEnd})
+			indented = -1
+		}
+		// A paragraph goes on lazily after the end of its blockquote, but a
+		// new blockquote interrupts it, and the items of a list only hold
+		// the lines within as many blockquotes
+		if quotes > quoted {
+			flush(start)
+		}
+		if open == nil && raw == nil && quotes != quoted && (paragraph < 0 || quotes > quoted) {
+			items = items[:0]
+			quoted = quotes
+		}
+		// A line leaves the items it isn't indented for, unless it goes on
+		// their paragraph
+		blocks := open == nil && raw == nil && indented < 0 && !isBlank(line)
+		if blocks && (paragraph < 0 || isListItem(bytes.TrimLeft(line, " \t"))) {
+			for len(items) > 0 && width < items[len(items)-1] {
+				items = items[:len(items)-1]
+			}
+		}
+		container := 0
+		if len(items) > 0 {
+			container = items[len(items)-1]
+		}
+		inner := dropIndent(line, container)
+		indent := width - container
+
+		wasInList := inList
+		if blocks {
+			if isListItem(inner) {
+				inList = true
+				items = append(items, container+listItemIndent(inner))
+			} else if width == 0 && paragraph < 0 {
+				inList = false
+			}
+		}
+		// A list item starting with a blank line has no content unless the
+		// next line is indented
+		if emptyItem && (isBlank(line) || (width == 0 && !isListItem(inner))) {
+			inList = false
+			if len(items) > 0 {
+				items = items[:len(items)-1]
+			}
+		}
+		emptyItem = blocks && isListItem(inner) && len(bytes.Fields(line)) == 1
+
+		defined := inDefinition
+		inDefinition = false
+		switch {
+		case open != nil:
+			if isClosingFence(dropIndent(line, open.indent), open) {
+				p.doc.code = append(p.doc.code, span{open.start, end})
+				open = nil
+			}
+		case raw != nil:
+			if raw.closing == "" && isBlank(line) {
+				p.doc.code = append(p.doc.code, span{raw.start, start})
+				raw = nil
+			} else if raw.closing != "" && raw.closedBy(line) {
+				p.doc.code = append(p.doc.code, span{raw.start, end})
+				raw = nil
+			}
+		case indented >= 0:
+			if !isBlank(line) {
+				indentedEnd = end
+			}
+		case isOpeningFence(inner):
+			flush(start)
+			open = newFence(inner, start)
+			open.indent, open.quotes = container, quotes
+		case openRawBlock(inner, start, paragraph >= 0) != nil:
+			flush(start)
+			raw = openRawBlock(inner, start, false)
+			raw.quotes = quotes
+			if raw.closing != "" && raw.closedBy(inner[raw.openingLength(inner):]) {
+				p.doc.code = append(p.doc.code, span{start, end})
+				raw = nil
+			}
+		case isBlank(line):
+			flush(start)
+		case indent >= 4 && paragraph < 0 && !defined && !(len(items) > 0 && isDefinition(line)):
+			indented, indentedEnd, indentedIn = start, end, container
+		case atxHeadingLevel(inner) > 0:
+			flush(start)
+			p.doc.headings = append(p.doc.headings, heading{span{start, end}, atxHeadingLevel(inner)})
+			p.paragraphs = append(p.paragraphs, span{start, end})
+		case paragraph >= 0 && setextHeadingLevel(inner) > 0:
+			p.doc.headings = append(p.doc.headings, heading{span{paragraph, end}, setextHeadingLevel(inner)})
+			flush(end)
+		default:
+			// A line within the text of a link or a code span is part of it
+			if d, last, ok := definitionAt(src, line, end, quotes); ok && (paragraph < 0 || !leavesInlineOpen(src[paragraph:start])) {
+				flush(start)
+				end = last
+				if d.isFootnote() {
+					end = footnoteEnd(src, end, &d)
+				}
+				d.span = span{start, end}
+				d.endsList = wasInList && !inList
+				p.doc.definitions = append(p.doc.definitions, d)
+				inDefinition = true
+			} else if paragraph < 0 {
+				paragraph = start
+				// Only the indentation past the one of the item is removed
+				if defined && indent >= 4 {
+					_, rest := leadingIndent(line)
+					lineStart := start + len(text) - len(line)
+					p.doc.indents = append(p.doc.indents, span{lineStart + indentLength(line, container), start + len(text) - len(rest)})
+				}
+			}
+		}
+		start = end
+	}
+
+	// An unclosed fence or block runs until the end of the document
+	if open != nil {
+		p.doc.code = append(p.doc.code, span{open.start, len(src)})
+		p.doc.unclosed = open.start
+	}
+	if raw != nil {
+		p.doc.code = append(p.doc.code, span{raw.start, len(src)})
+		p.doc.unclosed = raw.start
+	}
+	if indented >= 0 {
+		p.doc.code = append(p.doc.code, span{indented, indentedEnd})
+	}
+	flush(len(src))
+}
+
+// parseInlines finds code spans, links and images within the given range.
+// Links cannot contain other links, so inside link text only images are parsed.
+func (p *parser) parseInlines(s span, inLink bool) {
+	src := p.doc.source
+	for i := s.start; i < s.end; {
+		switch src[i] {
+		case '\\':
+			i += 2
+		case '`':
+			i = p.codeSpan(i, s.end)
+		case '<':
+			end := autolinkEnd(src, i, s.end)
+			if end < 0 {
+				i++
+				continue
+			}
+			if !inLink {
+				p.doc.autolinks = append(p.doc.autolinks, autolink{span: span{i, end}, url: string(src[i+1 : end-1])})
+			}
+			i = end
+		case '^':
+			// ^[^1] is a caret before a footnote reference
+			if i+2 < s.end && src[i+1] == '[' && src[i+2] != '^' && !inLink && !p.inFootnote {
+				if closing := matchBracket(src, i+1, s.end); closing > i+2 {
+					node := linkNode{span: span{i, closing + 1}, kind: inlineFootnote, text: span{i + 2, closing}}
+					p.doc.links = append(p.doc.links, node)
+					p.inFootnote = true
+					p.parseInlines(node.text, false)
+					p.inFootnote = false
+					i = node.end
+					continue
+				}
+			}
+			i++
+		case '!':
+			if i+1 < s.end && src[i+1] == '[' {
+				if node, ok := p.link(i+1, s.end, true); ok {
+					p.doc.links = append(p.doc.links, node)
+					i = node.end
+					continue
+				}
+				i += 2
+				continue
+			}
+			i++
+		case '[':
+			if !inLink {
+				if node, ok := p.link(i, s.end, false); ok {
+					p.doc.links = append(p.doc.links, node)
+					p.parseInlines(node.text, true)
+					i = node.end
+					continue
+				}
+			}
+			i++
+		default:
+			if !inLink && (i == s.start || isBareURLBoundary(src[i-1])) {
+				if end := bareURLEnd(src, i, s.end); end > 0 {
+					url := string(src[i:end])
+					if strings.HasPrefix(url, "www.") {
+						url = "http://" + url
+					}
+					p.doc.autolinks = append(p.doc.autolinks, autolink{span: span{i, end}, url: url, bare: true})
+					i = end
+					continue
+				}
+			}
+			i++
+		}
+	}
+}
+
+// findDestinations records the parts of the paragraph within parentheses
+// opened right after a link, or after what may end one once rewritten
+func (p *parser) findDestinations(s span) {
+	src := p.doc.source
+	depth, open := 0, 0
+	for i := s.start; i < s.end; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '(':
+			if depth > 0 || (i > 0 && closesLink(src[i-1])) {
+				if depth == 0 {
+					open = i + 1
+				}
+				depth++
+			}
+		case ')':
+			if depth > 0 {
+				depth--
+				if depth == 0 {
+					p.doc.destinations = append(p.doc.destinations, span{open, i + 1})
+				}
+			}
+		}
+	}
+	if depth > 0 {
+		p.doc.destinations = append(p.doc.destinations, span{open, s.end})
+	}
+}
+
+// codeSpan records the code span starting at the backtick run at pos and
+// returns the position right after it. A backtick run without a matching
+// closing run is literal text.
+func (p *parser) codeSpan(pos, end int) int {
+	closing, n := findCodeSpanEnd(p.doc.source, pos, end)
+	if closing < 0 {
+		return pos + n
+	}
+	p.doc.code = append(p.doc.code, span{pos, closing})
+	return closing
+}
+
+// link tries to parse a link whose text opens with the bracket at pos
+func (p *parser) link(pos, end int, image bool) (linkNode, bool) {
+	src := p.doc.source
+	closing := matchBracket(src, pos, end)
+	if closing < 0 {
+		return linkNode{}, false
+	}
+
+	node := linkNode{image: image, text: span{pos + 1, closing}}
+	node.start = pos
+	if image {
+		node.start--
+	}
+	text := string(src[pos+1 : closing])
+	isFootnote := !image && strings.HasPrefix(text, "^") && len(text) > 1
+
+	next := closing + 1
+	// As in GFM, a defined footnote is referenced whatever follows it
+	if isFootnote && p.labels[normalizeLabel(text)] {
+		node.label = text
+		node.end = next
+		node.kind = footnoteReference
+		return node, true
+	}
+	if next < end && src[next] == '(' {
+		if destination, title, n, ok := parseInlineTarget(src[next+1 : end]); ok && (image || !p.containsLink(node.text)) {
+			node.kind = inlineLink
+			node.destination = destination
+			node.title = title
+			node.end = next + n + 2
+			return node, true
+		}
+	}
+	if next < end && src[next] == '[' {
+		if labelEnd := findLabelEnd(src, next, end); labelEnd >= 0 && (image || !p.containsLink(node.text)) {
+			label, kind := string(src[next+1:labelEnd]), fullReferenceLink
+			if strings.TrimSpace(label) == "" {
+				label, kind = text, collapsedReferenceLink
+			}
+			// A label starting with a caret is a footnote's, and a label
+			// cannot be blank
+			if normalized := normalizeLabel(label); normalized != "" && !strings.HasPrefix(normalized, "^") {
+				node.label, node.kind, node.end = label, kind, labelEnd+1
+				return node, true
+			}
+		}
+	}
+
+	node.label = text
+	node.end = closing + 1
+	if isFootnote {
+		node.kind = footnoteReference
+		return node, true
+	}
+	if label := normalizeLabel(text); !strings.HasPrefix(label, "^") && p.labels[label] {
+		node.kind = shortcutReferenceLink
+		return node, true
+	}
+	p.doc.bracketed = append(p.doc.bracketed, text)
+	return linkNode{}, false
+}
+
+// containsLink tells if the text holds a link. As in CommonMark, links
+// cannot contain other links, and the inner one wins.
+func (p *parser) containsLink(s span) bool {
+	src := p.doc.source
+	for i := s.start; i < s.end; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '`':
+			closing, n := findCodeSpanEnd(src, i, s.end)
+			if closing < 0 {
+				closing = i + n
+			}
+			i = closing - 1
+		case '!':
+			if i+1 < s.end && src[i+1] == '[' {
+				if image, ok := p.link(i+1, s.end, true); ok {
+					i = image.end - 1
+				} else {
+					i++
+				}
+			}
+		case '[':
+			if l, ok := p.link(i, s.end, false); ok && l.kind != footnoteReference {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseDefinition parses a single line as a link reference definition or a
+// footnote definition. Unlike CommonMark, any indentation is accepted.
+func parseDefinition(line []byte) (definition, bool) {
+	d, _, ok := parseDefinitionLines([][]byte{line})
+	return d, ok
+}
+
+// parseDefinitionLines parses a definition starting with the first of the
+// lines. The destination and the title of a link reference definition may
+// each go on the next line, the number of lines it takes is returned too.
+func parseDefinitionLines(lines [][]byte) (definition, int, bool) {
+	s := bytes.TrimLeft(lines[0], " \t")
+	if len(s) == 0 || s[0] != '[' {
+		return definition{}, 0, false
+	}
+	labelEnd := findLabelEnd(s, 0, len(s))
+	if labelEnd < 0 || labelEnd+1 >= len(s) || s[labelEnd+1] != ':' {
+		return definition{}, 0, false
+	}
+	d := definition{label: string(s[1:labelEnd])}
+	if strings.TrimSpace(d.label) == "" {
+		return definition{}, 0, false
+	}
+	rest := s[labelEnd+2:]
+
+	if d.isFootnote() {
+		d.destination = string(bytes.TrimSpace(rest))
+		return d, 1, d.destination != ""
+	}
+
+	n := 1
+	rest = bytes.TrimLeft(rest, " \t")
+	if len(rest) == 0 && len(lines) > 1 {
+		rest = bytes.TrimLeft(lines[1], " \t")
+		n++
+	}
+	destination, m, ok := parseDestination(rest)
+	if !ok || m == 0 {
+		return definition{}, 0, false
+	}
+	d.destination = destination
+
+	after := rest[m:]
+	if len(bytes.TrimSpace(after)) == 0 {
+		// A title on the next line belongs to the definition, the line is a
+		// paragraph of its own otherwise
+		if n < len(lines) {
+			next := bytes.TrimSpace(lines[n])
+			if title, t, ok := parseTitle(next); ok && t == len(next) {
+				d.title = title
+				n++
+			}
+		}
+		return d, n, true
+	}
+	if after[0] != ' ' && after[0] != '\t' {
+		return definition{}, 0, false
+	}
+	after = bytes.TrimLeft(after, " \t")
+	title, t, ok := parseTitle(after)
+	if !ok || len(bytes.TrimSpace(after[t:])) != 0 {
+		return definition{}, 0, false
+	}
+	d.title = title
+	return d, n, true
+}
+
+// definitionAt parses the definition starting with the line ending at end,
+// given without its blockquote markers. The lines going on with it must be
+// within as many blockquotes. It returns the end of its last line.
+func definitionAt(src, line []byte, end, quotes int) (definition, int, bool) {
+	lines, ends := [][]byte{line}, []int{end}
+	if s := bytes.TrimLeft(line, " \t"); len(s) > 0 && s[0] == '[' {
+		for len(lines) < 3 && ends[len(ends)-1] < len(src) {
+			start := ends[len(ends)-1]
+			next := lineEnd(src, start)
+			depth, rest := quoteMarkers(trimLineEnding(src[start:next]))
+			if depth != quotes {
+				break
+			}
+			lines, ends = append(lines, rest), append(ends, next)
+		}
+	}
+	d, n, ok := parseDefinitionLines(lines)
+	if !ok {
+		return definition{}, end, false
+	}
+	return d, ends[n-1], true
+}
+
+// isDefinition tells if the line is a link reference definition or the first
+// line of a footnote definition
+func isDefinition(line []byte) bool {
+	_, ok := parseDefinition(line)
+	return ok
+}
+
+// footnoteEnd returns the end of the footnote definition whose first line
+// ends at pos, adding the lines continuing it to its text: the indented lines
+// right after it and, after blank lines, the lines indented by four spaces
+func footnoteEnd(src []byte, pos int, d *definition) int {
+	end := pos
+	blanks := 0
+	for start := pos; start < len(src); {
+		next := lineEnd(src, start)
+		line := trimLineEnding(src[start:next])
+		start = next
+		if isBlank(line) {
+			blanks++
+			continue
+		}
+		indent, _ := leadingIndent(line)
+		if indent == 0 || (blanks > 0 && indent < 4) {
+			break
+		}
+		if _, ok := parseDefinition(line); ok {
+			break
+		}
+		d.destination += strings.Repeat("\n", blanks+1) + string(bytes.TrimRight(line, " \t\r"))
+		blanks = 0
+		end = next
+	}
+	return end
+}
+
+// parseInlineTarget parses what follows the opening parenthesis of an inline
+// link: an optional destination, an optional title and the closing
+// parenthesis. It returns the number of bytes consumed up to, but not
+// including, the closing parenthesis.
+func parseInlineTarget(b []byte) (destination, title string, n int, ok bool) {
+	i := skipWhitespace(b, 0)
+	destination, m, ok := parseDestination(b[i:])
+	if !ok {
+		return "", "", 0, false
+	}
+	i += m
+
+	j := skipWhitespace(b, i)
+	if j > i && j < len(b) && (b[j] == '"' || b[j] == '\'' || b[j] == '(') {
+		var t int
+		title, t, ok = parseTitle(b[j:])
+		if !ok {
+			return "", "", 0, false
+		}
+		j = skipWhitespace(b, j+t)
+	}
+	if j >= len(b) || b[j] != ')' {
+		return "", "", 0, false
+	}
+	return destination, title, j, true
+}
+
+// parseDestination parses a link destination, either `<...>` or a run of
+// non-whitespace characters with balanced parentheses
+func parseDestination(b []byte) (string, int, bool) {
+	if len(b) > 0 && b[0] == '<' {
+		for i := 1; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case '\n', '<':
+				return "", 0, false
+			case '>':
+				return string(b[1:i]), i + 1, true
+			}
+		}
+		return "", 0, false
+	}
+
+	depth := 0
+	i := 0
+loop:
+	for ; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '\\' && i+1 < len(b) && isPunctuation(b[i+1]):
+			i++
+		case c <= ' ':
+			break loop
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		}
+	}
+	if depth != 0 {
+		return "", 0, false
+	}
+	return string(b[:i]), i, true
+}
+
+// parseTitle parses a link title in double quotes, single quotes or parentheses
+func parseTitle(b []byte) (string, int, bool) {
+	if len(b) == 0 {
+		return "", 0, false
+	}
+	closing := b[0]
+	switch closing {
+	case '"', '\'':
+	case '(':
+		closing = ')'
+	default:
+		return "", 0, false
+	}
+	for i := 1; i < len(b); i++ {
+		switch {
+		case b[i] == '\\':
+			i++
+		case b[i] == closing:
+			return string(b[1:i]), i + 1, true
+		case b[0] == '(' && b[i] == '(':
+			return "", 0, false
+		}
+	}
+	return "", 0, false
+}
+
+// matchBracket returns the position of the bracket closing the one at pos,
+// skipping escaped brackets and code spans, or -1 if there is none
+func matchBracket(src []byte, pos, end int) int {
+	depth := 0
+	for i := pos + 1; i < end; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '`':
+			closing, n := findCodeSpanEnd(src, i, end)
+			if closing < 0 {
+				i += n - 1
+			} else {
+				i = closing - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// findLabelEnd returns the position of the bracket closing a link label
+// opened at pos. Labels cannot contain unescaped brackets.
+func findLabelEnd(src []byte, pos, end int) int {
+	for i := pos + 1; i < end; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			return -1
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// findCodeSpanEnd looks for a backtick run of the same length as the one at
+// pos. It returns the position right after the closing run (or -1) and the
+// length of the opening run.
+func findCodeSpanEnd(src []byte, pos, end int) (int, int) {
+	n := backtickRun(src, pos, end)
+	for i := pos + n; i < end; {
+		if src[i] != '`' {
+			i++
+			continue
+		}
+		m := backtickRun(src, i, end)
+		if m == n {
+			return i + m, n
+		}
+		i += m
+	}
+	return -1, n
+}
+
+func backtickRun(src []byte, pos, end int) int {
+	n := 0
+	for pos+n < end && src[pos+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// autolinkEnd returns the position right after an autolink (`<scheme:...>`)
+// starting at pos, or -1 if there is none
+func autolinkEnd(src []byte, pos, end int) int {
+	i := pos + 1
+	for i < end && (isASCIILetter(src[i]) || (i > pos+1 && (isDigit(src[i]) || src[i] == '+' || src[i] == '.' || src[i] == '-'))) {
+		i++
+	}
+	if n := i - pos - 1; n < 2 || n > 32 || i >= end || src[i] != ':' {
+		return -1
+	}
+	for ; i < end; i++ {
+		switch c := src[i]; {
+		case c == '>':
+			return i + 1
+		case c <= ' ' || c == '<':
+			return -1
+		}
+	}
+	return -1
+}
+
+// bareURLEnd returns the position right after a GFM extended autolink
+// (`https://...`, `http://...` or `www....`) starting at pos, or -1 if there
+// is none. Trailing punctuation, unbalanced closing parentheses, brackets,
+// backticks and angle brackets are not part of the URL.
+func bareURLEnd(src []byte, pos, end int) int {
+	i := pos
+	switch rest := src[pos:end]; {
+	case bytes.HasPrefix(rest, []byte("https://")):
+		i += len("https://")
+	case bytes.HasPrefix(rest, []byte("http://")):
+		i += len("http://")
+	case bytes.HasPrefix(rest, []byte("www.")):
+	default:
+		return -1
+	}
+
+	domainStart, dots := i, 0
+	for i < end && (isASCIILetter(src[i]) || isDigit(src[i]) || src[i] == '-' || src[i] == '_' || src[i] == '.') {
+		if src[i] == '.' {
+			dots++
+		}
+		i++
+	}
+	if i == domainStart || dots == 0 || src[i-1] == '.' && dots == 1 {
+		return -1
+	}
+	domainEnd := i
+	// Unlike GFM, brackets, backticks and closing angle brackets end the URL,
+	// for the text around it to keep the brackets and the code spans it holds
+	// when the URL is rewritten as a link or put in angle brackets
+	for i < end && src[i] > ' ' && !strings.ContainsRune("<>[]`", rune(src[i])) {
+		i++
+	}
+
+	for i > domainStart {
+		switch src[i-1] {
+		case '?', '!', '.', ',', ':', '*', '_', '~':
+			i--
+			continue
+		case ')':
+			if bytes.Count(src[pos:i], []byte("(")) < bytes.Count(src[pos:i], []byte(")")) {
+				i--
+				continue
+			}
+		}
+		break
+	}
+	// The trailing punctuation may have held all the dots of the domain
+	if i < domainEnd {
+		domainEnd = i
+	}
+	if bytes.IndexByte(src[domainStart:domainEnd], '.') < 0 {
+		return -1
+	}
+	return i
+}
+
+// isBareURLBoundary tells if a bare URL may start after the given character
+func isBareURLBoundary(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '*' || c == '_' || c == '~' || c == '('
+}
+
+// atxHeadingLevel returns the level of the heading (`## Title`) on the line,
+// or 0 if it isn't one
+func atxHeadingLevel(line []byte) int {
+	indent, rest := leadingIndent(line)
+	if indent > 3 {
+		return 0
+	}
+	level := 0
+	for level < len(rest) && rest[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(rest) && rest[level] != ' ' && rest[level] != '\t') {
+		return 0
+	}
+	return level
+}
+
+// setextHeadingLevel returns the level of the heading underlined by the line
+// (1 for `===`, 2 for `---`), or 0 if it isn't an underline
+func setextHeadingLevel(line []byte) int {
+	indent, rest := leadingIndent(line)
+	rest = bytes.TrimRight(rest, " \t")
+	if indent > 3 || len(rest) == 0 || len(bytes.Trim(rest, string(rest[:1]))) != 0 {
+		return 0
+	}
+	switch rest[0] {
+	case '=':
+		return 1
+	case '-':
+		return 2
+	}
+	return 0
+}
+
+// htmlBlockTags are the names of the tags opening an HTML block that ends
+// before the next blank line
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "base": true, "basefont": true, "blockquote": true,
+	"body": true, "caption": true, "center": true, "col": true, "colgroup": true, "dd": true,
+	"details": true, "dialog": true, "dir": true, "div": true, "dl": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true, "frame": true,
+	"frameset": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "head": true, "header": true, "hr": true, "html": true, "iframe": true,
+	"legend": true, "li": true, "link": true, "main": true, "menu": true, "menuitem": true,
+	"nav": true, "noframes": true, "ol": true, "optgroup": true, "option": true, "p": true,
+	"param": true, "search": true, "section": true, "summary": true, "table": true, "tbody": true,
+	"td": true, "tfoot": true, "th": true, "thead": true, "title": true, "tr": true,
+	"track": true, "ul": true,
+}
+
+// openRawBlock returns the HTML block, following the start conditions of
+// CommonMark, or the math block (`$$`) opened by the line, or nil. A
+// paragraph can only be interrupted by some kinds of HTML blocks.
+func openRawBlock(line []byte, start int, inParagraph bool) *rawBlock {
+	indent, rest := leadingIndent(line)
+	if indent > 3 || len(rest) == 0 {
+		return nil
+	}
+	if bytes.HasPrefix(rest, []byte("$$")) {
+		return &rawBlock{start: start, closing: "$$"}
+	}
+	if rest[0] != '<' {
+		return nil
+	}
+
+	lower := bytes.ToLower(rest)
+	for _, tag := range []string{"script", "pre", "style", "textarea"} {
+		if bytes.HasPrefix(lower[1:], []byte(tag)) && (len(lower) == len(tag)+1 || strings.IndexByte(" \t>", lower[len(tag)+1]) >= 0) {
+			return &rawBlock{start: start, closing: "</" + tag + ">", foldCase: true}
+		}
+	}
+	switch {
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		return &rawBlock{start: start, closing: "-->"}
+	case bytes.HasPrefix(rest, []byte("<?")):
+		return &rawBlock{start: start, closing: "?>"}
+	case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+		return &rawBlock{start: start, closing: "]]>"}
+	case len(rest) > 2 && rest[1] == '!' && isASCIILetter(rest[2]):
+		return &rawBlock{start: start, closing: ">"}
+	}
+
+	name, after := htmlTagName(lower)
+	if htmlBlockTags[name] && (len(after) == 0 || after[0] == ' ' || after[0] == '\t' || after[0] == '>' || bytes.HasPrefix(after, []byte("/>"))) {
+		return &rawBlock{start: start}
+	}
+	if !inParagraph && name != "" && isCompleteTag(rest) {
+		return &rawBlock{start: start}
+	}
+	return nil
+}
+
+// openingLength returns the length of the text opening the block on its
+// first line, after which the closing text is looked for
+func (b *rawBlock) openingLength(line []byte) int {
+	_, rest := leadingIndent(line)
+	opening := 1
+	switch b.closing {
+	case "$$", "?>":
+		opening = 2
+	case "-->":
+		opening = 4
+	case "]]>":
+		opening = 9
+	case ">":
+		opening = 2
+	}
+	return len(line) - len(rest) + opening
+}
+
+// closedBy tells if the line holds the text closing the block
+func (b *rawBlock) closedBy(line []byte) bool {
+	if b.foldCase {
+		line = bytes.ToLower(line)
+	}
+	return bytes.Contains(line, []byte(b.closing))
+}
+
+// htmlTagName returns the lowercase name of the opening or closing tag the
+// text starts with, and the text following it
+func htmlTagName(lower []byte) (string, []byte) {
+	i := 1
+	if i < len(lower) && lower[i] == '/' {
+		i++
+	}
+	if i >= len(lower) || !isASCIILetter(lower[i]) {
+		return "", nil
+	}
+	j := i
+	for j < len(lower) && (isASCIILetter(lower[j]) || isDigit(lower[j]) || lower[j] == '-') {
+		j++
+	}
+	return string(lower[i:j]), lower[j:]
+}
+
+// isCompleteTag tells if the text is a single opening or closing tag,
+// followed by nothing but whitespace
+func isCompleteTag(text []byte) bool {
+	text = bytes.TrimRight(text, " \t")
+	_, after := htmlTagName(bytes.ToLower(text))
+	if len(after) == 0 || after[len(after)-1] != '>' {
+		return false
+	}
+	after = after[:len(after)-1]
+	if len(after) > 0 && after[0] != ' ' && after[0] != '\t' && !bytes.Equal(after, []byte("/")) {
+		return false
+	}
+	if text[1] == '/' {
+		return isBlank(after)
+	}
+	// The attributes hold no other tag, and their quotes are balanced
+	var quote byte
+	for _, c := range after {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '<' || c == '>':
+			return false
+		}
+	}
+	return quote == 0
+}
+
+// leavesInlineOpen tells if the text leaves the text or the destination of
+// a link open, or a backtick run that no run of the same length closes
+func leavesInlineOpen(text []byte) bool {
+	brackets, parentheses := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '`':
+			if parentheses > 0 {
+				// Inside a destination, backticks and brackets are plain text
+				continue
+			}
+			closing, _ := findCodeSpanEnd(text, i, len(text))
+			if closing < 0 {
+				return true
+			}
+			i = closing - 1
+		case '[':
+			if parentheses == 0 {
+				brackets++
+			}
+		case ']':
+			if brackets > 0 && parentheses == 0 {
+				brackets--
+			}
+		case '(':
+			if parentheses > 0 || (i > 0 && closesLink(text[i-1])) {
+				parentheses++
+			}
+		case ')':
+			if parentheses > 0 {
+				parentheses--
+			}
+		default:
+			// A bare URL is plain text, whatever it holds
+			if parentheses == 0 && (i == 0 || isBareURLBoundary(text[i-1])) {
+				if end := bareURLEnd(text, i, len(text)); end > 0 {
+					i = end - 1
+				}
+			}
+		}
+	}
+	return brackets > 0 || parentheses > 0
+}
+
+// closesLink tells if the character may end a link, as it is written or
+// once rewritten, so that a parenthesis following it may open a destination
+func closesLink(c byte) bool {
+	return c == ']' || c == ')' || c == '>'
+}
+
+// isListItem tells if the line starts a bullet or ordered list item
+func isListItem(line []byte) bool {
+	indent, rest := leadingIndent(line)
+	if indent > 3 || len(rest) == 0 {
+		return false
+	}
+	i := 0
+	if rest[0] == '-' || rest[0] == '*' || rest[0] == '+' {
+		i = 1
+	} else {
+		for i < len(rest) && i < 9 && isDigit(rest[i]) {
+			i++
+		}
+		if i == 0 || i >= len(rest) || (rest[i] != '.' && rest[i] != ')') {
+			return false
+		}
+		i++
+	}
+	return i == len(rest) || rest[i] == ' ' || rest[i] == '\t'
+}
+
+// quoteMarkers returns the number of blockquote markers starting the line and
+// the rest of the line, without the space following each of them
+func quoteMarkers(line []byte) (int, []byte) {
+	quotes := 0
+	for {
+		indent, rest := leadingIndent(line)
+		if indent > 3 || len(rest) == 0 || rest[0] != '>' {
+			return quotes, line
+		}
+		line = rest[1:]
+		if len(line) > 0 && line[0] == ' ' {
+			line = line[1:]
+		}
+		quotes++
+	}
+}
+
+// listItemIndent returns the indentation of the content of the list item
+// started by the line: the width of the marker and of the spaces after it, of
+// which there are one to four. More spaces start indented code, and an empty
+// item is followed by one.
+func listItemIndent(line []byte) int {
+	indent, rest := leadingIndent(line)
+	marker := 1
+	if rest[0] != '-' && rest[0] != '*' && rest[0] != '+' {
+		marker = bytes.IndexAny(rest, ".)") + 1
+	}
+	// Tabs after the marker are expanded from the column they are at
+	width, content := leadingIndent(append(bytes.Repeat([]byte(" "), indent+marker), rest[marker:]...))
+	spaces := width - indent - marker
+	if len(content) == 0 || spaces > 4 {
+		spaces = 1
+	}
+	return indent + marker + spaces
+}
+
+// dropIndent returns the line without the given width of indentation, or
+// without its indentation if there is less
+func dropIndent(line []byte, width int) []byte {
+	columns := 0
+	for i, c := range line {
+		if columns >= width {
+			return line[i:]
+		}
+		switch c {
+		case ' ':
+			columns++
+		case '\t':
+			columns += 4 - columns%4
+			if columns > width {
+				// The part of the tab past the width is kept as spaces
+				return append(bytes.Repeat([]byte(" "), columns-width), line[i+1:]...)
+			}
+		default:
+			return line[i:]
+		}
+	}
+	return nil
+}
+
+// indentLength returns the number of bytes of the indentation of the line
+// that make up its first width columns. A tab reaching past them is counted
+// whole, as it cannot be split.
+func indentLength(line []byte, width int) int {
+	columns := 0
+	for i, c := range line {
+		if columns >= width {
+			return i
+		}
+		switch c {
+		case ' ':
+			columns++
+		case '\t':
+			columns += 4 - columns%4
+		default:
+			return i
+		}
+	}
+	return len(line)
+}
+
+func isOpeningFence(line []byte) bool {
+	indent, rest := leadingIndent(line)
+	if indent > 3 || len(rest) < 3 || (rest[0] != '`' && rest[0] != '~') {
+		return false
+	}
+	n := backtickOrTildeRun(rest)
+	if n < 3 {
+		return false
+	}
+	// The info string of a backtick fence cannot contain backticks
+	return rest[0] != '`' || bytes.IndexByte(rest[n:], '`') < 0
+}
+
+func newFence(line []byte, start int) *fence {
+	_, rest := leadingIndent(line)
+	return &fence{char: rest[0], length: backtickOrTildeRun(rest), start: start}
+}
+
+func isClosingFence(line []byte, f *fence) bool {
+	indent, rest := leadingIndent(line)
+	if indent > 3 || len(rest) == 0 || rest[0] != f.char {
+		return false
+	}
+	n := backtickOrTildeRun(rest)
+	return n >= f.length && isBlank(rest[n:])
+}
+
+func backtickOrTildeRun(b []byte) int {
+	n := 0
+	for n < len(b) && b[n] == b[0] {
+		n++
+	}
+	return n
+}
+
+// leadingIndent returns the width of the line's indentation, with tabs
+// expanded to the next multiple of four, and the rest of the line
+func leadingIndent(line []byte) (int, []byte) {
+	width := 0
+	for i, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width, line[i:]
+		}
+	}
+	return width, nil
+}
+
+// textStart returns the start of the first line of the source, after the
+// byte order mark if there is one
+func textStart(src []byte) int {
+	if bytes.HasPrefix(src, byteOrderMark) {
+		return len(byteOrderMark)
+	}
+	return 0
+}
+
+// lineStart returns the start of the line holding the position
+func lineStart(src []byte, pos int) int {
+	start := bytes.LastIndexByte(src[:pos], '\n') + 1
+	if first := textStart(src); start < first {
+		return first
+	}
+	return start
+}
+
+func lineEnd(src []byte, start int) int {
+	if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+		return start + i + 1
+	}
+	return len(src)
+}
+
+func trimLineEnding(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+func skipWhitespace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// normalizeLabel makes labels comparable the way CommonMark matches them:
+// case-insensitively and with runs of whitespace collapsed
+func normalizeLabel(label string) string {
+	if isNormalizedLabel(label) {
+		return label
+	}
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// isNormalizedLabel is a shortcut for the most common labels, lowercase
+// ASCII without any whitespace to collapse
+func isNormalizedLabel(label string) bool {
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c >= utf8.RuneSelf || (c >= 'A' && c <= 'Z') || (c <= ' ' && (i == 0 || i == len(label)-1 || label[i-1] <= ' ' || c != ' ')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPunctuation(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,338 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	t.Run("finds inline and reference links", func(t *testing.T) {
+		content := []byte(`[Google](https://www.google.com) and [GitHub][1]
+
+[1]: https://github.com`)
+
+		doc := parseDocument(content)
+
+		assertLinkNodes(t, doc, []linkNode{
+			{kind: inlineLink, destination: "https://www.google.com"},
+			{kind: fullReferenceLink, label: "1"},
+		})
+		if len(doc.definitions) != 1 || doc.definitions[0].destination != "https://github.com" {
+			t.Errorf("Expected one definition of https://github.com, but got %+v", doc.definitions)
+		}
+	})
+
+	t.Run("ignores links in fenced code blocks", func(t *testing.T) {
+		content := []byte("Some text\n\n```markdown\n[Google](https://www.google.com)\n[1]: https://github.com\n```\n\n~~~\n[Example](https://example.com)\n~~~\n")
+
+		doc := parseDocument(content)
+
+		assertLinkNodes(t, doc, nil)
+		if len(doc.definitions) != 0 {
+			t.Errorf("Expected no definitions, but got %+v", doc.definitions)
+		}
+	})
+
+	t.Run("ignores links in unclosed fenced code blocks", func(t *testing.T) {
+		content := []byte("````\n[Google](https://www.google.com)\n```\n")
+
+		assertLinkNodes(t, parseDocument(content), nil)
+	})
+
+	t.Run("ignores links in code spans", func(t *testing.T) {
+		content := []byte("Use `[Google](https://www.google.com)` or ``[a](b) ` c`` but [this](https://example.com)")
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: inlineLink, destination: "https://example.com"},
+		})
+	})
+
+	t.Run("handles parentheses and titles in destinations", func(t *testing.T) {
+		content := []byte(`[Go](https://en.wikipedia.org/wiki/Go_(programming_language)) [a](<https://example.com/a b> "Title") [b](https://example.com 'Other')`)
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: inlineLink, destination: "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+			{kind: inlineLink, destination: "https://example.com/a b", title: "Title"},
+			{kind: inlineLink, destination: "https://example.com", title: "Other"},
+		})
+	})
+
+	t.Run("recognizes collapsed, shortcut and footnote references", func(t *testing.T) {
+		content := []byte(`[Example][] [example] [Invalid Link] footnote[^1]
+
+[Example]: https://example.com
+[^1]: some footnote`)
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: collapsedReferenceLink, label: "Example"},
+			{kind: shortcutReferenceLink, label: "example"},
+			{kind: footnoteReference, label: "^1"},
+		})
+	})
+
+	t.Run("recognizes inline footnotes", func(t *testing.T) {
+		content := []byte(`Text^[with [a link](https://example.com) and ^[no nested note]] and ^[] or \^[escaped]`)
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: inlineFootnote},
+			{kind: inlineLink, destination: "https://example.com"},
+		})
+	})
+
+	t.Run("recognizes images", func(t *testing.T) {
+		content := []byte(`[![logo](logo.png)](https://example.com)`)
+
+		doc := parseDocument(content)
+
+		assertLinkNodes(t, doc, []linkNode{
+			{kind: inlineLink, destination: "https://example.com"},
+			{kind: inlineLink, destination: "logo.png", image: true},
+		})
+	})
+
+	t.Run("ignores escaped brackets", func(t *testing.T) {
+		content := []byte(`\[not a link](https://example.com)`)
+
+		assertLinkNodes(t, parseDocument(content), nil)
+	})
+
+	t.Run("prefers the inner of nested links", func(t *testing.T) {
+		content := []byte(`[see [Go](https://go.dev)](https://example.com)`)
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: inlineLink, destination: "https://go.dev"},
+		})
+	})
+
+	t.Run("prefers defined footnotes", func(t *testing.T) {
+		content := []byte("[^1][Go] and [^2](https://go.dev)\n\n[^1]: Note\n[Go]: https://go.dev")
+
+		assertLinkNodes(t, parseDocument(content), []linkNode{
+			{kind: footnoteReference, label: "^1"},
+			{kind: shortcutReferenceLink, label: "Go"},
+			{kind: inlineLink, destination: "https://go.dev"},
+		})
+	})
+}
+
+func TestParseAutolinks(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []string
+	}{
+		{"See <https://example.com> or <mailto:me@example.com>", []string{"https://example.com", "mailto:me@example.com"}},
+		{"Visit https://example.com/path?q=1. Or www.example.com, maybe", []string{"https://example.com/path?q=1", "http://www.example.com"}},
+		{"(see https://en.wikipedia.org/wiki/Go_(programming_language))", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"*https://example.com*", []string{"https://example.com"}},
+		{"Not a URL: https://localhost nor xhttps://example.com nor <not a link>", nil},
+		{"`https://example.com` [https://example.com](https://example.com) [<https://example.com>][1]", nil},
+		{"```\nhttps://example.com\n```\n", nil},
+		{"[see https://example.com/a]`b` and www.. or https://x..", []string{"https://example.com/a"}},
+	}
+
+	for _, test := range tests {
+		doc := parseDocument([]byte(test.content))
+		var urls []string
+		for _, a := range doc.autolinks {
+			urls = append(urls, a.url)
+		}
+		if strings.Join(urls, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Expected autolinks %q in %q, but got %q", test.expected, test.content, urls)
+		}
+	}
+}
+
+func TestParseDestinations(t *testing.T) {
+	content := []byte("[a](b)(see [c](d) (e)) and [x](y)(f [g](h)\n\n[i](j)\n")
+	doc := parseDocument(content)
+
+	for _, l := range doc.links {
+		expected := l.destination == "d" || l.destination == "h"
+		if doc.opensDestination(l.start) != expected {
+			t.Errorf("Expected the link to %s to be within a destination: %v", l.destination, expected)
+		}
+	}
+	if doc.opensDestination(len(content)) {
+		t.Errorf("Expected the end of the document not to be within a destination")
+	}
+}
+
+func TestParseHeadings(t *testing.T) {
+	content := []byte("# One\n\ntext\n\n  ### Three ###\n#hashtag\n\nSetext\ntitle\n===\n\nOther\n---\n\n```\n# Not a heading\n```\n")
+
+	doc := parseDocument(content)
+
+	expected := []heading{{span{0, 6}, 1}, {span{13, 29}, 3}, {span{39, 56}, 1}, {span{57, 67}, 2}}
+	if len(doc.headings) != len(expected) {
+		t.Fatalf("Expected headings %+v, but got %+v", expected, doc.headings)
+	}
+	for i, h := range doc.headings {
+		if h != expected[i] {
+			t.Errorf("Expected heading %+v, but got %+v", expected[i], h)
+		}
+	}
+}
+
+func TestParseBlocksOfCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		links   int
+	}{
+		{"HTML block ending at a blank line", "<table>\n<td>[a](b)</td>\n\n[c](d)\n", 1},
+		{"HTML block closed on its line", "<!-- [a](b) --> [c](d)\n[e](f)\n", 1},
+		{"script closed later", "<script>\nlet x = '[a](b)'\n\n</SCRIPT>\n[c](d)\n", 1},
+		{"inline HTML in a paragraph", "Text <span>[a](b)</span>\n<span>\n[c](d)\n", 2},
+		{"autolink starting a line", "<https://example.com> [a](b)\n", 1},
+		{"math block", "$$\n[a](b)\n$$\n[c](d)\n", 1},
+		{"one-line math block", "$$ [a](b) $$\n[c](d)\n", 1},
+		{"indented code", "Text\n\n    [a](b)\n\n    [c](d)\n[e](f)\n", 1},
+		{"indented line continuing a paragraph", "Text\n    [a](b)\n", 1},
+		{"indented lines in a list", "- Item\n\n    [a](b)\n", 1},
+		{"indented code in a list item", "- Item\n\n      [a](b)\n\n  [c](d)\n", 1},
+		{"indented code in an ordered list item", "10. Item\n\n        [a](b)\n", 0},
+		{"fenced code in a nested list item", "- Item\n  - Nested\n\n    ~~~\n    [a](b)\n    ~~~\n    [c](d)\n", 1},
+		{"indented code starting the document", "\t[1]\n", 0},
+		{"indented code after definitions", "[1]: 0\n\n\t[1]\n", 0},
+		{"fenced code in a blockquote", "> ```\n> [a](b)\n> ```\n> [c](d)\n", 1},
+		{"fenced code ending with its blockquote", "> ```\n> [a](b)\n\n[c](d)\n", 1},
+		{"indented code in a blockquote", ">     [a](b)\n\n    [c](d)\n", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parseDocument([]byte(test.content))
+			if len(doc.links) != test.links {
+				t.Errorf("Expected %d links, but got %+v", test.links, doc.links)
+			}
+		})
+	}
+}
+
+func TestParseDefinitionLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		want       definition
+		paragraphs int
+	}{
+		{"title on the next line", "[a]: https://a.com\n  \"The title\"\n", definition{label: "a", destination: "https://a.com", title: "The title"}, 0},
+		{"destination on the next line", "[a]:\n  https://a.com\n", definition{label: "a", destination: "https://a.com"}, 0},
+		{"destination and title on their own lines", "[a]:\n<https://a.com>\n(The title)\n", definition{label: "a", destination: "https://a.com", title: "The title"}, 0},
+		{"text on the next line", "[a]: https://a.com\n\"Not\" a title\n", definition{label: "a", destination: "https://a.com"}, 1},
+		{"in a blockquote", "> Text\n>\n> [a]: https://a.com\n", definition{label: "a", destination: "https://a.com"}, 1},
+		{"in a blockquote with the title on the next line", "> [a]:\n> https://a.com\n> \"The title\"\n", definition{label: "a", destination: "https://a.com", title: "The title"}, 0},
+		{"title out of the blockquote", "> [a]: https://a.com\n\"Text\"\n", definition{label: "a", destination: "https://a.com"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := parseDocument([]byte(test.content))
+			if len(doc.definitions) != 1 {
+				t.Fatalf("Expected one definition, but got %+v", doc.definitions)
+			}
+			if d := doc.definitions[0]; d.label != test.want.label || d.destination != test.want.destination || d.title != test.want.title {
+				t.Errorf("Expected %+v, but got %+v", test.want, d)
+			}
+			p := parser{doc: &document{source: []byte(test.content)}}
+			p.parseBlocks()
+			if len(p.paragraphs) != test.paragraphs {
+				t.Errorf("Expected %d paragraphs, but got %+v", test.paragraphs, p.paragraphs)
+			}
+		})
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		line  string
+		valid bool
+		want  definition
+	}{
+		{"[1]: https://github.com", true, definition{label: "1", destination: "https://github.com"}},
+		{`  [ref]: <https://example.com> "Title"`, true, definition{label: "ref", destination: "https://example.com", title: "Title"}},
+		{"[^note]: some footnote", true, definition{label: "^note", destination: "some footnote"}},
+		{"[GitHub][1]: nope", false, definition{}},
+		{"- [Craft][1]: Test", false, definition{}},
+		{"[1]: https://github.com some text", false, definition{}},
+		{"[]: https://github.com", false, definition{}},
+	}
+
+	for _, test := range tests {
+		d, ok := parseDefinition([]byte(test.line))
+		if ok != test.valid {
+			t.Errorf("Expected %q to be a definition: %v, but got %v", test.line, test.valid, ok)
+			continue
+		}
+		if d.label != test.want.label || d.destination != test.want.destination || d.title != test.want.title {
+			t.Errorf("Expected %q to be parsed as %+v, but got %+v", test.line, test.want, d)
+		}
+	}
+}
+
+// FuzzParseDocument checks that parsing any document finds links,
+// definitions and code within it, the definitions in order
+func FuzzParseDocument(f *testing.F) {
+	for _, seed := range []string{
+		"[Google](https://www.google.com) and [GitHub][1]\n\n[1]: https://github.com",
+		"![Image](<image (1).png> 'title') ^[inline [note](url)] and [^1]\n\n[^1]: Footnote\n    text",
+		"```\n[code](url)\n```\n\n<div>\n[html](url)\n</div>\n\n`[span](url)` www.example.com",
+		"Title\n=====\n\n    [indented](url)\n\n- [item](url \"title\")",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		doc := parseDocument([]byte(content))
+		within := func(s span) bool {
+			return 0 <= s.start && s.start <= s.end && s.end <= len(content)
+		}
+		for _, l := range doc.links {
+			if !within(l.span) || l.text.start < l.start || l.text.end > l.end || l.text.start > l.text.end {
+				t.Errorf("Expected the link %+v and its text to be within %d bytes", l, len(content))
+			}
+		}
+		for _, a := range doc.autolinks {
+			if !within(a.span) {
+				t.Errorf("Expected the autolink %+v to be within %d bytes", a, len(content))
+			}
+		}
+		previous := 0
+		for _, d := range doc.definitions {
+			if !within(d.span) || d.start < previous {
+				t.Errorf("Expected the definition %+v to be within %d bytes, after %d", d, len(content), previous)
+			}
+			previous = d.end
+		}
+		for _, s := range doc.code {
+			if !within(s) {
+				t.Errorf("Expected the code %+v to be within %d bytes", s, len(content))
+			}
+		}
+	})
+}
+
+func assertLinkNodes(t *testing.T, doc *document, expected []linkNode) {
+	t.Helper()
+	if len(doc.links) != len(expected) {
+		t.Fatalf("Expected %d links, but got %d: %+v", len(expected), len(doc.links), doc.links)
+	}
+
+	for i, link := range doc.links {
+		if link.kind != expected[i].kind {
+			t.Errorf("Expected link %d to be of kind %d, but got %d", i, expected[i].kind, link.kind)
+		}
+		if link.image != expected[i].image {
+			t.Errorf("Expected link %d image flag to be %v, but got %v", i, expected[i].image, link.image)
+		}
+		if link.label != expected[i].label {
+			t.Errorf("Expected link %d label '%s', but got '%s'", i, expected[i].label, link.label)
+		}
+		if link.destination != expected[i].destination {
+			t.Errorf("Expected link %d destination '%s', but got '%s'", i, expected[i].destination, link.destination)
+		}
+		if link.title != expected[i].title {
+			t.Errorf("Expected link %d title '%s', but got '%s'", i, expected[i].title, link.title)
+		}
+	}
+}
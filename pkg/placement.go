@@ -0,0 +1,202 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Placement tells where the definitions of the links go
+type Placement string
+
+const (
+	// PlacementEnd puts all definitions at the end of the file
+	PlacementEnd Placement = "end"
+	// PlacementSection puts the definitions at the end of the section in
+	// which the links are first used, before the next heading
+	PlacementSection Placement = "section"
+	// PlacementMarkers puts the definitions between the ReferencesStart and
+	// ReferencesEnd markers, added at the end of the file if missing
+	PlacementMarkers Placement = "markers"
+)
+
+const (
+	// ReferencesStart is the line after which the definitions go with PlacementMarkers
+	ReferencesStart = "<!-- references -->"
+	// ReferencesEnd is the line closing the definitions with PlacementMarkers
+	ReferencesEnd = "<!-- /references -->"
+)
+
+// ParsePlacement returns the placement with the given name
+func ParsePlacement(name string) (Placement, error) {
+	switch placement := Placement(name); placement {
+	case PlacementEnd, PlacementSection, PlacementMarkers:
+		return placement, nil
+	case "":
+		return PlacementEnd, nil
+	}
+	return "", fmt.Errorf("unknown placement %q, expected end, section or markers", name)
+}
+
+// placeDefinitions returns the edits inserting the definitions of the links
+// where the placement puts them in the document, and the links whose
+// definitions go at the end of the file
+func (c *MarkdownConverter) placeDefinitions(doc *document, links []Link) ([]edit, []Link) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+	switch c.options.Placement {
+	case PlacementSection:
+		return c.sectionDefinitions(doc, links)
+	case PlacementMarkers:
+		start, end, ok := findMarkers(doc)
+		if !ok {
+			return nil, links
+		}
+		block := "\n" + buildReferenceLinks(links, c.options.IDs) + "\n\n"
+		if doc.source[start-1] != '\n' {
+			block = "\n" + block
+		}
+		if end < 0 {
+			block += ReferencesEnd + "\n"
+		}
+		return []edit{{span: span{start, start}, replacement: block}}, nil
+	}
+	return nil, links
+}
+
+// endOfFileDefinitions returns the definitions going at the end of the file,
+// between markers if they should be and there are none yet
+func (c *MarkdownConverter) endOfFileDefinitions(links []Link) string {
+	definitions := buildReferenceLinks(links, c.options.IDs)
+	if c.options.Placement == PlacementMarkers {
+		return ReferencesStart + "\n\n" + definitions + "\n\n" + ReferencesEnd
+	}
+	return definitions
+}
+
+// sectionDefinitions puts the definitions of the links at the end of the
+// section in which they are first used. Links that are never used go at the
+// end of the file, with the links of the last section.
+func (c *MarkdownConverter) sectionDefinitions(doc *document, links []Link) ([]edit, []Link) {
+	var boundaries []int
+	for _, h := range doc.headings {
+		if c.options.SectionLevel <= 0 || h.level <= c.options.SectionLevel {
+			boundaries = append(boundaries, h.start)
+		}
+	}
+
+	firstUses := c.firstUses(doc)
+	sections := make(map[int][]Link)
+	var rest []Link
+	for _, link := range links {
+		position, ok := firstUses[normalizeLabel(link.ID)]
+		if !ok {
+			rest = append(rest, link)
+			continue
+		}
+		// The first heading after the first use ends its section
+		i := sort.SearchInts(boundaries, position+1)
+		if i == len(boundaries) {
+			rest = append(rest, link)
+			continue
+		}
+		sections[boundaries[i]] = append(sections[boundaries[i]], link)
+	}
+
+	var edits []edit
+	for _, boundary := range boundaries {
+		if links, ok := sections[boundary]; ok {
+			edits = append(edits, edit{span: span{boundary, boundary}, replacement: "\n" + buildReferenceLinks(links, c.options.IDs) + "\n\n"})
+		}
+	}
+	return edits, rest
+}
+
+// firstUses returns the position of the first use of every link, by
+// normalized ID
+func (c *MarkdownConverter) firstUses(doc *document) map[string]int {
+	ids := make(map[linkKey]string)
+	for _, link := range c.Links {
+		if _, ok := ids[keyOf(link)]; !ok && link.URL != "" && !link.IsFootnote() {
+			ids[keyOf(link)] = link.ID
+		}
+	}
+
+	uses := make(map[string]int)
+	use := func(id string, position int) {
+		id = normalizeLabel(id)
+		if previous, ok := uses[id]; id != "" && (!ok || position < previous) {
+			uses[id] = position
+		}
+	}
+	for _, l := range doc.links {
+		switch {
+		case l.isReference():
+			use(c.newLabel(l.label), l.start)
+		case l.kind == footnoteReference:
+			use(c.newFootnoteLabel(l.label), l.start)
+		case l.kind == inlineFootnote:
+			use(c.footnotes.inline[l.start], l.start)
+		case l.kind == inlineLink:
+			use(ids[linkKey{l.destination, l.title, l.image}], l.start)
+		}
+	}
+	if c.options.Autolinks == AutolinksReference {
+		for _, a := range doc.autolinks {
+			use(ids[linkKey{url: a.url}], a.start)
+		}
+	}
+	return uses
+}
+
+// newLabel returns the label of the reference after renumbering
+func (c *MarkdownConverter) newLabel(label string) string {
+	if id, ok := c.renumbered[normalizeLabel(label)]; ok {
+		return id
+	}
+	return label
+}
+
+// newFootnoteLabel returns the label of the footnote reference after
+// renumbering
+func (c *MarkdownConverter) newFootnoteLabel(label string) string {
+	if id, ok := c.footnotes.labels[normalizeLabel(label)]; ok {
+		return id
+	}
+	return label
+}
+
+// findMarkers returns the position right after the line holding the
+// ReferencesStart marker and the position of the line holding the
+// ReferencesEnd marker following it, or -1 if there is none. Markers in
+// code are ignored, but not the ones making an HTML block of their own.
+func findMarkers(doc *document) (int, int, bool) {
+	src := doc.source
+	start, end := -1, -1
+	for pos := textStart(src); pos < len(src); {
+		next := lineEnd(src, pos)
+		line := string(bytes.TrimSpace(src[pos:next]))
+		switch {
+		case withinCode(doc, pos):
+		case start < 0 && line == ReferencesStart:
+			start = next
+		case start >= 0 && line == ReferencesEnd:
+			end = pos
+			return start, end, true
+		}
+		pos = next
+	}
+	return start, end, start >= 0
+}
+
+// withinCode tells if the line starting at the position is within a code,
+// HTML or math block that started before it
+func withinCode(doc *document, pos int) bool {
+	for _, s := range doc.code {
+		if pos > s.start && pos < s.end {
+			return true
+		}
+	}
+	return false
+}
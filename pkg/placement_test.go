@@ -0,0 +1,147 @@
+package converter
+
+import "testing"
+
+func TestPlacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		content  string
+		expected string
+	}{
+		{
+			name:    "puts definitions at the end of each section",
+			options: Options{Placement: PlacementSection},
+			content: `# Title
+
+Intro with [Google](https://www.google.com).
+
+## First
+
+See [GitHub](https://github.com) and [Google](https://www.google.com) again[^1].
+
+Second
+------
+
+Nothing here, [GitHub][gh] is defined below.
+
+## Last
+
+The [end](https://example.com).
+
+[gh]: https://github.com/lubieniebieski
+[^1]: A footnote.
+[unused]: https://example.com/unused
+`,
+			expected: `# Title
+
+Intro with [Google][1].
+
+[1]: https://www.google.com
+
+## First
+
+See [GitHub][2] and [Google][1] again[^1].
+
+[2]: https://github.com
+
+[^1]: A footnote.
+
+Second
+------
+
+Nothing here, [GitHub][gh] is defined below.
+
+[gh]: https://github.com/lubieniebieski
+
+## Last
+
+The [end][3].
+
+[3]: https://example.com
+
+[unused]: https://example.com/unused
+`,
+		},
+		{
+			name:    "ends sections at the given heading level",
+			options: Options{Placement: PlacementSection, SectionLevel: 1},
+			content: `# One
+
+[a](https://example.com/a)
+
+## Sub
+
+[b](https://example.com/b)
+
+# Two
+
+[c](https://example.com/c)
+`,
+			expected: `# One
+
+[a][1]
+
+## Sub
+
+[b][2]
+
+[1]: https://example.com/a
+[2]: https://example.com/b
+
+# Two
+
+[c][3]
+
+[3]: https://example.com/c
+`,
+		},
+		{
+			name:    "puts definitions between markers",
+			options: Options{Placement: PlacementMarkers},
+			content: `Text with [a link](https://example.com).
+
+## Links
+
+<!-- references -->
+[old]: https://example.com/old
+<!-- /references -->
+
+Footer with [another](https://example.com/another) [old][].
+`,
+			expected: `Text with [a link][1].
+
+## Links
+
+<!-- references -->
+
+[1]: https://example.com
+[2]: https://example.com/another
+
+[old]: https://example.com/old
+
+<!-- /references -->
+
+Footer with [another][2] [old][].
+`,
+		},
+		{
+			name:     "adds missing markers",
+			options:  Options{Placement: PlacementMarkers},
+			content:  "Text with [a link](https://example.com).\n\n```\n<!-- references -->\n```\n",
+			expected: "Text with [a link][1].\n\n```\n<!-- references -->\n```\n\n<!-- references -->\n\n[1]: https://example.com\n\n<!-- /references -->\n",
+		},
+		{
+			name:     "adds the closing marker",
+			options:  Options{Placement: PlacementMarkers},
+			content:  "Text with [a link](https://example.com).\n\n<!-- references -->",
+			expected: "Text with [a link][1].\n\n<!-- references -->\n\n[1]: https://example.com\n\n<!-- /references -->\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compareConvertResultsWithOptions(t, test.options, []byte(test.content), []byte(test.expected))
+		})
+	}
+}
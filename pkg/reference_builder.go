@@ -6,7 +6,18 @@ import (
 	"strings"
 )
 
+// BuildReferenceLinks returns the definitions of the links, numbered
+// references first, then the other ones, images and footnotes, each group
+// sorted by ID
 func BuildReferenceLinks(links []Link) (output string) {
+	return buildReferenceLinks(links, IDsNumeric)
+}
+
+// buildReferenceLinks builds the definitions in the order suiting the ID
+// strategy: the numeric one keeps numbered references apart from the other
+// ones, slugs and domains are sorted together, hashes keep the order the
+// links were found in
+func buildReferenceLinks(links []Link, strategy IDStrategy) (output string) {
 
 	if len(links) == 0 {
 		return
@@ -14,41 +25,73 @@ func BuildReferenceLinks(links []Link) (output string) {
 
 	var numberedRefs []string
 	var otherRefs []string
+	var imageRefs []string
 	var footnotes []string
 
-	// Sort links by ID
-	sort.Slice(links, func(i, j int) bool {
-		num1, err1 := strconv.Atoi(links[i].ID)
-		num2, err2 := strconv.Atoi(links[j].ID)
-		if err1 == nil && err2 == nil {
-			return num1 < num2
-		} else if err1 != nil && err2 != nil {
-			return links[i].ID < links[j].ID
-		} else {
-			return err1 == nil
-		}
-	})
+	// Sort links by ID, hashes would only shuffle them
+	if strategy != IDsHash {
+		sort.Slice(links, func(i, j int) bool {
+			num1, err1 := strconv.Atoi(links[i].ID)
+			num2, err2 := strconv.Atoi(links[j].ID)
+			if err1 == nil && err2 == nil {
+				return num1 < num2
+			} else if err1 != nil && err2 != nil {
+				return naturalLess(links[i].ID, links[j].ID)
+			} else {
+				return err1 == nil
+			}
+		})
+	}
 
-	// Separate links into numbered references, other references, and footnotes
+	// Separate links into numbered references, other references, images and footnotes
 	for _, link := range links {
 		if link.IsFootnote() {
 			footnotes = append(footnotes, link.AsReference())
-		} else if link.IsReference() {
+		} else if link.Image {
+			imageRefs = append(imageRefs, link.AsReference())
+		} else if link.IsReference() || (strategy != "" && strategy != IDsNumeric) {
 			otherRefs = append(otherRefs, link.AsReference())
 		} else {
 			numberedRefs = append(numberedRefs, link.AsReference())
 		}
 	}
 
-	// Combine the three lists of links into a single list
-	if len(numberedRefs) > 0 && len(otherRefs) > 0 {
-		numberedRefs = append(numberedRefs, "")
+	// Combine the lists of links into a single list, separated by empty lines
+	var allConvertedLinks []string
+	for _, refs := range [][]string{numberedRefs, otherRefs, imageRefs, footnotes} {
+		if len(allConvertedLinks) > 0 && len(refs) > 0 {
+			allConvertedLinks = append(allConvertedLinks, "")
+		}
+		allConvertedLinks = append(allConvertedLinks, refs...)
 	}
-	allConvertedLinks := append(numberedRefs, otherRefs...)
-	if len(allConvertedLinks) > 0 && len(footnotes) > 0 {
-		allConvertedLinks = append(allConvertedLinks, "")
+	return strings.Join(allConvertedLinks, "\n")
+}
+
+// naturalLess compares the IDs with the numbers in them compared by value,
+// so that github-com-2 comes before github-com-10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		chunkA, restA := leadingChunk(a)
+		chunkB, restB := leadingChunk(b)
+		if chunkA != chunkB {
+			numA, errA := strconv.Atoi(chunkA)
+			numB, errB := strconv.Atoi(chunkB)
+			if errA == nil && errB == nil && numA != numB {
+				return numA < numB
+			}
+			return chunkA < chunkB
+		}
+		a, b = restA, restB
 	}
+	return len(a) < len(b)
+}
 
-	allConvertedLinks = append(allConvertedLinks, footnotes...)
-	return strings.Join(allConvertedLinks, "\n")
+// leadingChunk splits the leading run of digits or non-digits off the string
+func leadingChunk(s string) (string, string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
 }
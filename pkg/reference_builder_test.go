@@ -1,6 +1,9 @@
 package converter
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestBuildReferenceLinks(t *testing.T) {
 	t.Run("returns empty string for empty input", func(t *testing.T) {
@@ -78,6 +81,56 @@ func TestBuildReferenceLinks(t *testing.T) {
 
 		assertReferencesEqual(t, links, expectedOutput)
 	})
+
+	t.Run("groups image definitions", func(t *testing.T) {
+		links := []Link{
+			{ID: "2", URL: "logo.png", Image: true},
+			{ID: "1", URL: "https://www.example1.com"},
+			{ID: "^1", URL: "some footnote"},
+			{ID: "pic", URL: "pic.png", Image: true},
+			{ID: "3", URL: "https://www.example3.com"},
+		}
+		expectedOutput := `[1]: https://www.example1.com
+[3]: https://www.example3.com
+
+[2]: logo.png
+[pic]: pic.png
+
+[^1]: some footnote`
+
+		assertReferencesEqual(t, links, expectedOutput)
+	})
+
+	t.Run("sorts numbers within IDs by value", func(t *testing.T) {
+		links := []Link{
+			{ID: "github-com-10", URL: "https://github.com/10"},
+			{ID: "github-com-2", URL: "https://github.com/2"},
+			{ID: "example-com-1", URL: "https://example.com"},
+		}
+		expectedOutput := `[example-com-1]: https://example.com
+[github-com-2]: https://github.com/2
+[github-com-10]: https://github.com/10`
+
+		if output := buildReferenceLinks(links, IDsDomain); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("keeps the order of hashes", func(t *testing.T) {
+		links := []Link{
+			{ID: "ac6bb66", URL: "https://www.google.com"},
+			{ID: "link-5221110", URL: "https://github.com/lubieniebieski"},
+			{ID: "^1", URL: "some footnote"},
+		}
+		expectedOutput := `[ac6bb66]: https://www.google.com
+[link-5221110]: https://github.com/lubieniebieski
+
+[^1]: some footnote`
+
+		if output := buildReferenceLinks(links, IDsHash); output != expectedOutput {
+			t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedOutput, output)
+		}
+	})
 }
 
 func assertReferencesEqual(t *testing.T, links []Link, expectedReferences string) {
@@ -85,3 +138,43 @@ func assertReferencesEqual(t *testing.T, links []Link, expectedReferences string
 		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectedReferences, output)
 	}
 }
+
+// FuzzBuildReferenceLinks checks that the definitions of any document,
+// written again, keep their labels, destinations and titles
+func FuzzBuildReferenceLinks(f *testing.F) {
+	for _, seed := range []string{
+		"[1]: https://www.google.com\n[ref]: https://github.com \"GitHub\"",
+		"[img]: <image (1).png>\n[^1]: A footnote\n    on two lines",
+		"[a\\]b]: https://example.com/a\\\n[B]: b 'it\\'s'",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		var links []Link
+		labels := make(map[string]bool)
+		for _, d := range parseDocument([]byte(content)).definitions {
+			if labels[normalizeLabel(d.label)] || strings.TrimSpace(d.destination) == "" {
+				continue
+			}
+			labels[normalizeLabel(d.label)] = true
+			links = append(links, Link{ID: d.label, URL: d.destination, Title: d.title})
+		}
+		expected := make(map[string]Link)
+		for _, link := range links {
+			expected[normalizeLabel(link.ID)] = link
+		}
+
+		output := BuildReferenceLinks(links)
+		definitions := parseDocument([]byte(output)).definitions
+		if len(definitions) != len(expected) {
+			t.Fatalf("Expected %d definitions in\n%q\nbut got %+v", len(expected), output, definitions)
+		}
+		for _, d := range definitions {
+			link, ok := expected[normalizeLabel(d.label)]
+			if !ok || d.destination != link.URL || d.title != link.Title {
+				t.Errorf("Expected %q to keep the definition %+v, but got %+v", output, link, d)
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package converter
+
+import "fmt"
+
+// ReferenceInliner converts reference links back to inline links in markdown
+// files, removing the definitions that are no longer used
+type ReferenceInliner struct {
+	originalContent []byte
+	modifiedContent []byte
+	Links           []Link
+	// edits turn the original content into the modified one
+	edits []edit
+}
+
+func (r *ReferenceInliner) Run() {
+	doc := parseDocument(r.originalContent)
+
+	definitions := make(map[string]definition)
+	for _, d := range doc.definitions {
+		label := normalizeLabel(d.label)
+		if _, ok := definitions[label]; !ok && !d.isFootnote() {
+			definitions[label] = d
+		}
+	}
+
+	var edits []edit
+	used := make(map[string]bool)
+	// Links come in the order of the document, the ones nested in a link
+	// right after it. enclosing holds the links around the current one.
+	var enclosing []int
+	for i, l := range doc.links {
+		for len(enclosing) > 0 && doc.links[enclosing[len(enclosing)-1]].end <= l.start {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		nested := r.isNestedInConverted(doc, l, enclosing, definitions)
+		enclosing = append(enclosing, i)
+
+		d, ok := r.definitionFor(l, definitions)
+		if !ok {
+			continue
+		}
+		used[normalizeLabel(d.label)] = true
+		// Images nested in the text of a converted link are converted with it
+		if nested {
+			continue
+		}
+
+		link := Link{Name: r.linkText(doc, i, definitions), URL: d.destination, ID: d.label, Title: d.title, Image: l.image}
+		r.Links = append(r.Links, link)
+		edits = append(edits, edit{span: l.span, replacement: inlineLinkText(link, l.image)})
+	}
+	for _, d := range doc.definitions {
+		if !used[normalizeLabel(d.label)] {
+			continue
+		}
+		edits = append(edits, removeDefinition(doc, d, func(d definition) bool { return used[normalizeLabel(d.label)] }))
+		for _, s := range doc.indents {
+			if s.start == d.end {
+				edits = append(edits, edit{span: s})
+			}
+		}
+	}
+
+	r.edits = tidyEdits(r.originalContent, edits)
+	r.modifiedContent = applyEdits(r.originalContent, r.edits)
+}
+
+func (r *ReferenceInliner) definitionFor(l linkNode, definitions map[string]definition) (definition, bool) {
+	if !l.isReference() {
+		return definition{}, false
+	}
+	d, ok := definitions[normalizeLabel(l.label)]
+	return d, ok
+}
+
+// isNestedInConverted tells if the link is in the text of one of the
+// enclosing links which is converted
+func (r *ReferenceInliner) isNestedInConverted(doc *document, l linkNode, enclosing []int, definitions map[string]definition) bool {
+	for _, j := range enclosing {
+		outer := doc.links[j]
+		if l.start < outer.text.start || l.end > outer.text.end {
+			continue
+		}
+		if _, ok := r.definitionFor(outer, definitions); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// linkText returns the text of the i-th link with the references nested in
+// it (images, as links cannot contain other links) converted too
+func (r *ReferenceInliner) linkText(doc *document, i int, definitions map[string]definition) string {
+	l := doc.links[i]
+	var edits []edit
+	for _, nested := range doc.links[i+1:] {
+		if nested.start >= l.end {
+			break
+		}
+		if nested.start < l.text.start || nested.end > l.text.end {
+			continue
+		}
+		if d, ok := r.definitionFor(nested, definitions); ok {
+			link := Link{Name: string(r.originalContent[nested.text.start:nested.text.end]), URL: d.destination, Title: d.title}
+			edits = append(edits, edit{
+				span:        span{nested.start - l.text.start, nested.end - l.text.start},
+				replacement: inlineLinkText(link, nested.image),
+			})
+		}
+	}
+	return string(applyEdits(r.originalContent[l.text.start:l.text.end], edits))
+}
+
+func inlineLinkText(link Link, image bool) string {
+	if !image {
+		return link.AsMarkdownLink()
+	}
+	// An image needs its brackets even without alt text
+	return fmt.Sprintf("![%s](%s)", link.Name, link.target())
+}
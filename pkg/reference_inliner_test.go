@@ -0,0 +1,165 @@
+package converter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReferenceInlinerRun(t *testing.T) {
+	t.Run("replaces references with inline links", func(t *testing.T) {
+		content := []byte(`[Google][1] fdafd
+[GitHub][gh] and [GitHub][] again
+[Invalid Link]
+
+[1]: https://www.google.com
+[gh]: https://github.com
+[GitHub]: https://github.com/lubieniebieski
+`)
+
+		expectedOutput := []byte(`[Google](https://www.google.com) fdafd
+[GitHub](https://github.com) and [GitHub](https://github.com/lubieniebieski) again
+[Invalid Link]
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("preserves titles", func(t *testing.T) {
+		content := []byte(`[Google][1]
+
+[1]: https://www.google.com "Search"
+`)
+
+		expectedOutput := []byte(`[Google](https://www.google.com "Search")
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps the line endings and the empty lines away from the changes", func(t *testing.T) {
+		content := []byte("[Google][1]\r\n\r\n\r\n\r\nText\r\n\r\n[1]: https://www.google.com\r\n\r\nMore text\r\n")
+
+		expectedOutput := []byte("[Google](https://www.google.com)\r\n\r\n\r\n\r\nText\r\n\r\nMore text\r\n")
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("preserves titles in all syntaxes", func(t *testing.T) {
+		content := []byte(`[a][1] [b][2] ![c][3]
+
+[1]: https://example.com 'Single "quoted"'
+[2]: <https://example.com/a b> (Parens)
+[3]: logo.png "Logo"
+`)
+
+		expectedOutput := []byte(`[a](https://example.com 'Single "quoted"') [b](<https://example.com/a b> "Parens") ![c](logo.png "Logo")
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("uses definitions spanning lines", func(t *testing.T) {
+		content := []byte(`[x][multi] and [y][titled]
+
+[multi]:
+  https://example.com/multi
+[titled]: https://example.com/titled
+  "Title"
+`)
+
+		expectedOutput := []byte(`[x](https://example.com/multi) and [y](https://example.com/titled "Title")
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("uses definitions in blockquotes", func(t *testing.T) {
+		content := []byte(`> See [x][q].
+>
+> [q]: https://example.com
+> "Quoted"
+
+After.
+`)
+
+		expectedOutput := []byte(`> See [x](https://example.com "Quoted").
+>
+
+After.
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("handles images", func(t *testing.T) {
+		content := []byte(`![Logo][logo] and [![Logo][logo]][site]
+
+[logo]: logo.png
+[site]: https://example.com
+`)
+
+		expectedOutput := []byte(`![Logo](logo.png) and [![Logo](logo.png)](https://example.com)
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("keeps footnotes and unused definitions", func(t *testing.T) {
+		content := []byte(`Text[^1] with [a link][1].
+
+[1]: https://example.com
+[unused]: https://example.com/unused
+
+[^1]: The footnote.
+`)
+
+		expectedOutput := []byte(`Text[^1] with [a link](https://example.com).
+
+[unused]: https://example.com/unused
+
+[^1]: The footnote.
+`)
+		compareInlineResults(t, content, expectedOutput)
+	})
+
+	t.Run("doesn't touch code samples", func(t *testing.T) {
+		content := []byte("Run `[a][1]`:\n\n```\n[GitHub][1]\n```\n\n[1]: https://github.com\n")
+
+		compareInlineResults(t, content, content)
+	})
+
+	t.Run("leaves content without references intact", func(t *testing.T) {
+		content := []byte("first line\n\n\n[Invalid Link]")
+
+		compareInlineResults(t, content, content)
+	})
+}
+
+func TestReferenceInlinerRoundTrip(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "links_as_references", "*.input.md"))
+	if err != nil {
+		t.Fatalf("Failed to list golden files: %v", err)
+	}
+
+	for _, input := range inputs {
+		content, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatalf("Failed to read input file: %v", err)
+		}
+
+		// Converting references and inlining them again must lead to the
+		// same document, up to where the remaining definitions are placed
+		expectedOutput := convert(inline(content))
+		if output := convert(inline(convert(content))); !bytes.Equal(output, expectedOutput) {
+			t.Errorf("%s: expected output:\n%s\n\nBut got:\n%s", input, expectedOutput, output)
+		}
+	}
+}
+
+func compareInlineResults(t *testing.T, input []byte, expectations []byte) {
+	t.Helper()
+	if output := inline(input); !bytes.Equal(output, expectations) {
+		t.Errorf("Expected output:\n%s\n\nBut got:\n%s", expectations, output)
+	}
+}
+
+func inline(content []byte) []byte {
+	inliner := ReferenceInliner{originalContent: content}
+	inliner.Run()
+	return inliner.modifiedContent
+}
@@ -0,0 +1,119 @@
+package converter
+
+import (
+	"sort"
+	"strconv"
+)
+
+// renumber gives the links with numeric IDs new numbers following the order
+// in which they are first used in the document. Defined links that are never
+// used come last, in their previous order. Numbers of references to labels
+// defined nowhere are kept, so that they don't start pointing somewhere.
+//
+// It returns the new IDs by normalized previous ID, for the references to
+// be updated.
+func (c *MarkdownConverter) renumber(doc *document) map[string]string {
+	defined := make(map[string]int)
+	reserved := make(map[int]bool)
+	for _, text := range c.bracketed {
+		if label := normalizeLabel(text); isNumericID(label) {
+			number, _ := strconv.Atoi(label)
+			reserved[number] = true
+		}
+	}
+	for i, link := range c.Links {
+		// [ 1] is defined by [1]: too
+		id := normalizeLabel(link.ID)
+		if !isNumericID(id) || link.IsFootnote() {
+			continue
+		}
+		if link.URL == "" {
+			number, _ := strconv.Atoi(id)
+			reserved[number] = true
+			continue
+		}
+		defined[id] = i
+	}
+	if len(defined) == 0 {
+		return nil
+	}
+
+	ids := make(map[linkKey]string)
+	for _, link := range c.Links {
+		if _, ok := ids[keyOf(link)]; !ok && link.URL != "" {
+			ids[keyOf(link)] = link.ID
+		}
+	}
+
+	// The IDs used by the links, in the order of the document
+	type use struct {
+		start int
+		id    string
+	}
+	var uses []use
+	for _, l := range doc.links {
+		switch {
+		case l.isReference():
+			uses = append(uses, use{l.start, l.label})
+		case l.kind == inlineLink:
+			uses = append(uses, use{l.start, ids[linkKey{l.destination, l.title, l.image}]})
+		}
+	}
+	if c.options.Autolinks == AutolinksReference {
+		for _, a := range doc.autolinks {
+			uses = append(uses, use{a.start, ids[linkKey{url: a.url}]})
+		}
+	}
+	sort.SliceStable(uses, func(i, j int) bool {
+		return uses[i].start < uses[j].start
+	})
+
+	var order []int
+	seen := make(map[int]bool)
+	for _, u := range uses {
+		if i, ok := defined[normalizeLabel(u.id)]; ok && !seen[i] {
+			seen[i] = true
+			order = append(order, i)
+		}
+	}
+	var unused []int
+	for _, i := range defined {
+		if !seen[i] {
+			unused = append(unused, i)
+		}
+	}
+	sort.Slice(unused, func(a, b int) bool {
+		numberA, _ := strconv.Atoi(normalizeLabel(c.Links[unused[a]].ID))
+		numberB, _ := strconv.Atoi(normalizeLabel(c.Links[unused[b]].ID))
+		return numberA < numberB
+	})
+	order = append(order, unused...)
+
+	renumbered := make(map[string]string)
+	number := 0
+	for _, i := range order {
+		number++
+		for reserved[number] {
+			number++
+		}
+		id := strconv.Itoa(number)
+		renumbered[normalizeLabel(c.Links[i].ID)] = id
+		c.Links[i].ID = id
+	}
+	// The IDs of the links changed
+	c.index = nil
+	return renumbered
+}
+
+// isNumericID tells if the ID is made of digits only
+func isNumericID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !isDigit(id[i]) {
+			return false
+		}
+	}
+	return true
+}
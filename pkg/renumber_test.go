@@ -0,0 +1,89 @@
+package converter
+
+import "testing"
+
+func TestRenumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		ids      IDStrategy
+		content  string
+		expected string
+	}{
+		{
+			name: "orders IDs by first use",
+			content: `[New](https://example.com/new) comes before [GitHub][3], [Google][1] and [GitHub again][3].
+See [2] and [Go][go].
+
+[1]: https://www.google.com
+[2]: https://example.com/two
+[3]: https://github.com
+[go]: https://go.dev
+`,
+			expected: `[New][1] comes before [GitHub][2], [Google][3] and [GitHub again][2].
+See [2][4] and [Go][go].
+
+[1]: https://example.com/new
+[2]: https://github.com
+[3]: https://www.google.com
+[4]: https://example.com/two
+
+[go]: https://go.dev
+`,
+		},
+		{
+			name: "puts unused definitions last",
+			content: `[Google][2] and [a link](https://example.com)
+
+[1]: https://unused.example.com
+[2]: https://www.google.com
+`,
+			expected: `[Google][1] and [a link][2]
+
+[1]: https://www.google.com
+[2]: https://example.com
+[3]: https://unused.example.com
+`,
+		},
+		{
+			name: "keeps numbers of undefined references",
+			content: `[Google][3] and [nothing][1]
+
+[3]: https://www.google.com
+`,
+			expected: `[Google][2] and [nothing][1]
+
+[2]: https://www.google.com
+`,
+		},
+		{
+			name: "renumbers images and collapsed references",
+			content: `![logo][2] and [1][]
+
+[1]: https://example.com
+[2]: logo.png
+`,
+			expected: `![logo][1] and [1][2]
+
+[2]: https://example.com
+
+[1]: logo.png
+`,
+		},
+		{
+			name:    "leaves hashes made of digits alone",
+			ids:     IDsHash,
+			content: "[a](https://e.com/2) and [b](https://example.com)\n",
+			expected: `[a][link-5117555] and [b][100680a]
+
+[link-5117555]: https://e.com/2
+[100680a]: https://example.com
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compareConvertResultsWithOptions(t, Options{Renumber: true, IDs: test.ids}, []byte(test.content), []byte(test.expected))
+		})
+	}
+}